@@ -1,6 +1,9 @@
 package client
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -8,11 +11,65 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-// ErrUnexpectedHTTPStatusCode is returned when the HTTP status is not 200
+// ErrUnexpectedHTTPStatusCode is matched by an *HTTPError, returned when the HTTP status is not 200
 var ErrUnexpectedHTTPStatusCode = fmt.Errorf("unexpected HTTP status code")
 
+// maxErrorBodySize is the maximum number of response body bytes kept by an HTTPError
+const maxErrorBodySize = 1024
+
+// errorHeaders are the response headers kept by an HTTPError
+var errorHeaders = []string{"Content-Type", "Content-Length", "Retry-After", "WWW-Authenticate", "Server", "Date"}
+
+// HTTPError is returned when the HTTP status is not 200. It matches
+// ErrUnexpectedHTTPStatusCode when tested with errors.Is.
+type HTTPError struct {
+	// StatusCode is the HTTP status code e.g. 503
+	StatusCode int
+	// Status is the HTTP status line e.g. "503 Service Unavailable"
+	Status string
+	// URL is the URL that was requested
+	URL string
+	// Header contains selected response headers such as Content-Type and Retry-After
+	Header http.Header
+	// Body is the start of the response body, truncated to 1KiB
+	Body []byte
+}
+
+func newHTTPError(res *http.Response) *HTTPError {
+	h := http.Header{}
+	for _, k := range errorHeaders {
+		if v := res.Header.Values(k); len(v) > 0 {
+			h[k] = v
+		}
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+
+	return &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		URL:        res.Request.URL.String(),
+		Header:     h,
+		Body:       b,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%v: %s from %s", ErrUnexpectedHTTPStatusCode, e.Status, e.URL)
+	if body := strings.TrimSpace(string(e.Body)); body != "" {
+		msg += ": " + body
+	}
+	return msg
+}
+
+// Is reports whether target is ErrUnexpectedHTTPStatusCode
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrUnexpectedHTTPStatusCode
+}
+
 // ErrParseFail is returned when parsing of metrics data fails
 var ErrParseFail = fmt.Errorf("failed to parse line")
 
@@ -40,7 +97,8 @@ type Metric struct {
 	Samples     []*Sample
 }
 
-// Sample is a sample taken for a particular metric.
+// Sample is a sample taken for a particular metric. Label values are stored
+// unescaped.
 type Sample struct {
 	Name      string
 	Labels    map[string]string
@@ -50,60 +108,318 @@ type Sample struct {
 
 // PromMetricsClient is a simple client that fetches and parses metrics from a prometheus /metrics endpoint.
 type PromMetricsClient struct {
+	// URL is the endpoint to scrape. As well as HTTP(S) URLs it may be a unix
+	// socket URL such as unix:///path/to/sock:/metrics, a file URL such as
+	// file:///path/to/metrics.txt or "-" to read from stdin. The socket path
+	// ends at the first ":", so it must not contain one. Stdin can only be
+	// read once, so "-" is never retried and is not suitable for repeated
+	// scrapes.
 	URL string
+	// TLSConfig configures TLS for HTTPS endpoints. Optional.
+	TLSConfig *TLSConfig
+	// OAuth2 configures OAuth2 client credentials authentication. Optional.
+	OAuth2 *OAuth2Config
+	// Retry configures retrying of failed requests. Optional.
+	Retry *RetryPolicy
+	// Limits restricts the size of scraped data. Optional.
+	Limits *Limits
+	// DisableCompression stops the client from requesting compressed responses.
+	DisableCompression bool
+	// Decoders are additional decoders for compressed responses, keyed by
+	// content coding e.g. "zstd". Gzip and deflate are supported by default.
+	Decoders map[string]Decoder
+
+	// tr holds the transports created on first use. It is a pointer so that
+	// the client can be copied.
+	tr *clientTransports
+}
+
+// clientTransports are the transports of a client
+type clientTransports struct {
+	mu   sync.Mutex
+	rt   http.RoundTripper
+	unix map[string]http.RoundTripper
+}
+
+// transportsMu guards the creation of clientTransports
+var transportsMu sync.Mutex
+
+func (c *PromMetricsClient) transports() *clientTransports {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if c.tr == nil {
+		c.tr = &clientTransports{}
+	}
+	return c.tr
+}
+
+// roundTripper returns the transport used for requests, creating it on first
+// use. Changes to the client configuration after the first request are not
+// applied.
+func (c *PromMetricsClient) roundTripper() (http.RoundTripper, error) {
+	ts := c.transports()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.rt != nil {
+		return ts.rt, nil
+	}
+
+	var rt http.RoundTripper = http.DefaultTransport
+	if c.TLSConfig != nil {
+		trt, err := newTLSRoundTripper(c.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		rt = trt
+	}
+
+	if c.OAuth2 != nil {
+		ort, err := newOAuth2RoundTripper(c.OAuth2, rt)
+		if err != nil {
+			return nil, err
+		}
+		rt = ort
+	}
+
+	ts.rt = rt
+	return rt, nil
 }
 
 // GetMetrics retrieves metrics from the stored URL
 func (c *PromMetricsClient) GetMetrics() ([]*Metric, error) {
-	res, err := http.Get(c.URL)
+	return c.GetMetricsContext(context.Background())
+}
+
+// GetMetricsContext retrieves metrics from the stored URL. The context
+// controls cancellation of the request and any retries.
+func (c *PromMetricsClient) GetMetricsContext(ctx context.Context) ([]*Metric, error) {
+	ms, _, err := c.fetch(ctx, c.URL, c.Limits)
+	return ms, err
+}
+
+// fetch retrieves metrics from the given URL, retrying according to the retry
+// policy, and parses them with the limits. It also returns the size of the
+// uncompressed response body.
+func (c *PromMetricsClient) fetch(ctx context.Context, url string, l *Limits) ([]*Metric, int64, error) {
+	// stdin can only be read once
+	if c.Retry == nil || url == "-" {
+		return c.fetchOnce(ctx, url, l)
+	}
+
+	var ms []*Metric
+	var n int64
+	err := c.Retry.do(ctx, func() error {
+		var err error
+		ms, n, err = c.fetchOnce(ctx, url, l)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ms, n, nil
+}
+
+func (c *PromMetricsClient) fetchOnce(ctx context.Context, target string, l *Limits) ([]*Metric, int64, error) {
+	body, err := c.open(ctx, target)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+
+	cr := &countingReader{r: body}
+	ms, err := ParseWithLimits(cr, l)
+	return ms, cr.n, err
+}
+
+// open opens the target for reading and returns the uncompressed body. The
+// target is a HTTP(S) URL, a unix socket URL, a file URL or "-" for stdin.
+func (c *PromMetricsClient) open(ctx context.Context, target string) (io.ReadCloser, error) {
+	switch {
+	case target == "-":
+		return openStdin()
+	case strings.HasPrefix(target, "file:"):
+		return openFile(ctx, target)
+	case strings.HasPrefix(target, "unix:"):
+		sock, path, err := parseUnixURL(target)
+		if err != nil {
+			return nil, err
+		}
+		rt, err := c.unixRoundTripper(sock)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.openHTTP(ctx, rt, "http://localhost"+path)
+		var herr *HTTPError
+		if errors.As(err, &herr) {
+			herr.URL = target
+		}
+		return body, err
+	}
+
+	rt, err := c.roundTripper()
+	if err != nil {
+		return nil, err
+	}
+	return c.openHTTP(ctx, rt, target)
+}
+
+func (c *PromMetricsClient) openHTTP(ctx context.Context, rt http.RoundTripper, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// always set Accept-Encoding, otherwise the transport requests gzip itself
+	if c.DisableCompression {
+		req.Header.Set("Accept-Encoding", "identity")
+	} else {
+		req.Header.Set("Accept-Encoding", c.acceptEncoding())
+	}
+
+	hc := http.Client{Transport: rt}
+	res, err := hc.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.StatusCode != 200 {
-		return nil, ErrUnexpectedHTTPStatusCode
+		defer res.Body.Close()
+		return nil, newHTTPError(res)
+	}
+
+	coding := res.Header.Get("Content-Encoding")
+	if coding == "" && c.Limits != nil && c.Limits.MaxBodyBytes > 0 && res.ContentLength > c.Limits.MaxBodyBytes {
+		res.Body.Close()
+		return nil, &LimitError{Limit: BodySizeLimit, Max: c.Limits.MaxBodyBytes, Line: -1}
+	}
+
+	body, err := c.decodeBody(res.Body, coding)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return &readCloser{Reader: body, closers: []io.Closer{body, res.Body}}, nil
+}
+
+// do sends a request using the client's transport, returning an *HTTPError
+// if the response status is not 2xx.
+func (c *PromMetricsClient) do(req *http.Request) (*http.Response, error) {
+	rt, err := c.roundTripper()
+	if err != nil {
+		return nil, err
 	}
 
-	defer res.Body.Close()
-	return Parse(res.Body)
+	hc := http.Client{Transport: rt}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, newHTTPError(res)
+	}
+	return res, nil
+}
+
+// readCloser is a reader that closes all of its closers when closed
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
 }
 
 var (
 	startHelpLineRE = regexp.MustCompile("^#\\s+HELP\\s+")
 	startTypeLineRE = regexp.MustCompile("^#\\s+TYPE\\s+")
 	wsRE            = regexp.MustCompile("\\s+")
-	labelRE         = regexp.MustCompile("([a-zA-Z_][a-zA-Z0-9_]*)\\s*=\\s*\"((?:\\\\\"|[^\"])*)\"")
+	labelRE         = regexp.MustCompile("([a-zA-Z_][a-zA-Z0-9_]*)\\s*=\\s*\"((?:\\\\.|[^\"\\\\])*)\"")
 )
 
 // Parse reads raw metrics data from the reader, parses it and returns the result
 func Parse(r io.Reader) ([]*Metric, error) {
-	b, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	return ParseWithLimits(r, nil)
+}
+
+// ParseWithLimits is like Parse but fails with a *LimitError as soon as the
+// data exceeds one of the limits. The data is parsed line by line, so it stops
+// reading at the first violation. A nil Limits means no limits.
+func ParseWithLimits(r io.Reader, l *Limits) ([]*Metric, error) {
+	var maxLine int
+	var cr *countingReader
+	if l != nil {
+		maxLine = l.MaxLineLength
+		if l.MaxBodyBytes > 0 {
+			cr = &countingReader{r: io.LimitReader(r, l.MaxBodyBytes+1)}
+			r = cr
+		}
 	}
 
+	br := bufio.NewReader(r)
+
 	var m *Metric
 	var ms []*Metric
+	var samples int
 
-	lns := strings.Split(string(b), "\n")
-
-	for i, ln := range lns {
-		if ln == "" || isCommentLine(ln) {
-			continue
-		}
-
-		nm, err := parseLine(m, ln, i)
+	for i := 0; ; i++ {
+		ln, eof, err := readLine(br, maxLine, i)
 		if err != nil {
 			return nil, err
 		}
 
-		if m == nil {
-			m = nm
+		if cr != nil && cr.n > l.MaxBodyBytes {
+			return nil, &LimitError{Limit: BodySizeLimit, Max: l.MaxBodyBytes, Line: -1}
+		}
+
+		if ln != "" && !isCommentLine(ln) {
+			nm, err := parseLine(m, ln, i)
+			if err != nil {
+				return nil, err
+			}
+
+			if l != nil && !isHelpLine(ln) && !isTypeLine(ln) {
+				samples++
+				if err := l.checkSample(nm.Samples[len(nm.Samples)-1], samples, i); err != nil {
+					return nil, err
+				}
+			}
+
+			if m == nil {
+				m = nm
+			}
+
+			if nm != m {
+				ms = append(ms, m)
+				m = nm
+			}
 		}
 
-		if nm != m {
-			ms = append(ms, m)
-			m = nm
+		if eof {
+			break
 		}
 	}
 
@@ -114,6 +430,36 @@ func Parse(r io.Reader) ([]*Metric, error) {
 	return ms, nil
 }
 
+// readLine reads line n without its trailing newline, reporting whether it is
+// the last line. If max is positive, it fails with a *LimitError as soon as
+// the line is longer than max, without reading the rest of it.
+func readLine(br *bufio.Reader, max int, n int) (string, bool, error) {
+	var b []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		b = append(b, chunk...)
+
+		length := len(b)
+		if err == nil {
+			length--
+		}
+		if max > 0 && length > max {
+			return "", false, &LimitError{Limit: LineLengthLimit, Max: int64(max), Line: n}
+		}
+
+		switch err {
+		case nil:
+			return string(b[:length]), false, nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			return string(b), true, nil
+		default:
+			return "", false, err
+		}
+	}
+}
+
 func parseLine(m *Metric, l string, n int) (*Metric, error) {
 	if isHelpLine(l) {
 		return parseHelpLine(m, l, n)
@@ -147,7 +493,7 @@ func parseHelpLine(m *Metric, l string, n int) (*Metric, error) {
 	m.Name = sp[0]
 
 	if len(sp) > 1 {
-		m.Description = sp[1]
+		m.Description = unescapeHelp(sp[1])
 	}
 
 	return m, nil
@@ -219,7 +565,52 @@ func parseLabels(s string) map[string]string {
 	ma := labelRE.FindAllStringSubmatch(s, -1)
 	lbs := make(map[string]string)
 	for _, sm := range ma {
-		lbs[sm[1]] = sm[2]
+		lbs[sm[1]] = unescapeLabelValue(sm[2])
 	}
 	return lbs
 }
+
+// unescapeLabelValue unescapes a label value as written in the text format
+func unescapeLabelValue(v string) string {
+	return unescape(v, '"')
+}
+
+// unescapeHelp unescapes HELP text as written in the text format
+func unescapeHelp(v string) string {
+	return unescape(v, 0)
+}
+
+// unescape replaces \\ and \n, and \ followed by quote if it is not 0.
+// Other escapes are kept as they are.
+func unescape(v string, quote byte) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+			switch {
+			case v[i] == 'n':
+				b.WriteByte('\n')
+			case v[i] == '\\' || (quote != 0 && v[i] == quote):
+				b.WriteByte(v[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(v[i])
+			}
+			continue
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+func copyLabels(lbs map[string]string) map[string]string {
+	c := make(map[string]string, len(lbs))
+	for k, v := range lbs {
+		c[k] = v
+	}
+	return c
+}
@@ -2,11 +2,14 @@ package client
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -86,6 +89,52 @@ func TestGetMemstatsTxt(t *testing.T) {
 	}
 }
 
+func TestGetUnexpectedHTTPStatusCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.Header().Set("X-Internal", "secret")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "overloaded"+strings.Repeat(".", 2048))
+	}))
+	defer srv.Close()
+
+	c := PromMetricsClient{URL: srv.URL + "/metrics"}
+
+	_, err := c.GetMetrics()
+	if !errors.Is(err, ErrUnexpectedHTTPStatusCode) {
+		t.Fatal("expected unexpected HTTP status code error")
+	}
+
+	var herr *HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatal("expected HTTPError")
+	}
+
+	if herr.StatusCode != 503 {
+		t.Fatal("incorrect status code")
+	}
+
+	if herr.Status != "503 Service Unavailable" {
+		t.Fatal("incorrect status")
+	}
+
+	if herr.URL != srv.URL+"/metrics" {
+		t.Fatal("incorrect URL")
+	}
+
+	if herr.Header.Get("Retry-After") != "120" {
+		t.Fatal("missing Retry-After header")
+	}
+
+	if herr.Header.Get("X-Internal") != "" {
+		t.Fatal("unexpected header")
+	}
+
+	if len(herr.Body) != 1024 || !strings.HasPrefix(string(herr.Body), "overloaded") {
+		t.Fatal("incorrect body snippet")
+	}
+}
+
 func TestParseMultisampleTxt(t *testing.T) {
 	content, err := ioutil.ReadFile("testdata/multisample.txt")
 	if err != nil {
@@ -215,11 +264,11 @@ func TestParseExampleTxt(t *testing.T) {
 		t.Fatal("incorrect sample labels length")
 	}
 
-	if m.Samples[0].Labels["path"] != "C:\\\\DIR\\\\FILE.TXT" {
+	if m.Samples[0].Labels["path"] != "C:\\DIR\\FILE.TXT" {
 		t.Fatal("incorrect sample label value")
 	}
 
-	if m.Samples[0].Labels["error"] != "Cannot find file:\\n\\\"FILE.TXT\\\"" {
+	if m.Samples[0].Labels["error"] != "Cannot find file:\n\"FILE.TXT\"" {
 		t.Fatal("incorrect sample label value")
 	}
 
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Decoder creates a reader that decompresses data read from r. Decoders are
+// keyed by HTTP content coding e.g. "zstd".
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+var builtinDecoders = map[string]Decoder{
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"deflate": zlib.NewReader,
+}
+
+// decoder returns the decoder for the content coding, preferring those
+// configured on the client over the built in gzip and deflate decoders.
+func (c *PromMetricsClient) decoder(coding string) (Decoder, bool) {
+	if d, ok := c.Decoders[coding]; ok {
+		return d, true
+	}
+	d, ok := builtinDecoders[coding]
+	return d, ok
+}
+
+// acceptEncoding returns the value of the Accept-Encoding request header
+func (c *PromMetricsClient) acceptEncoding() string {
+	codings := []string{"gzip", "deflate"}
+	var extra []string
+	for k := range c.Decoders {
+		if _, ok := builtinDecoders[k]; !ok {
+			extra = append(extra, k)
+		}
+	}
+	sort.Strings(extra)
+	return strings.Join(append(codings, extra...), ", ")
+}
+
+// decodeBody wraps the response body with a decompressing reader for the
+// given Content-Encoding.
+func (c *PromMetricsClient) decodeBody(body io.Reader, coding string) (io.ReadCloser, error) {
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	if coding == "" || coding == "identity" {
+		return ioutil.NopCloser(body), nil
+	}
+
+	d, ok := c.decoder(coding)
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", coding)
+	}
+
+	r, err := d(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", coding, err)
+	}
+	return r, nil
+}
+
+// maybeGunzip returns a reader that decompresses r if it starts with the gzip
+// magic number, otherwise it reads r as is.
+func maybeGunzip(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// ParseAuto is like Parse but first decompresses the data if it is gzip
+// compressed.
+func ParseAuto(r io.Reader) ([]*Metric, error) {
+	zr, err := maybeGunzip(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return Parse(zr)
+}
+
+// ParseFile reads and parses the named file, which may be gzip compressed
+func ParseFile(name string) ([]*Metric, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAuto(f)
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newCompressingServer serves memstats.txt compressed with the given content
+// coding if the client accepts it, recording the Accept-Encoding header.
+func newCompressingServer(t *testing.T, coding string, accept *string) *httptest.Server {
+	content, err := ioutil.ReadFile("testdata/memstats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*accept = req.Header.Get("Accept-Encoding")
+		if !strings.Contains(*accept, coding) {
+			w.Write(content)
+			return
+		}
+
+		var zw io.WriteCloser
+		if coding == "deflate" {
+			zw = zlib.NewWriter(w)
+		} else {
+			zw = gzip.NewWriter(w)
+		}
+		w.Header().Set("Content-Encoding", coding)
+		zw.Write(content)
+		zw.Close()
+	}))
+}
+
+func TestGetGzip(t *testing.T) {
+	var accept string
+	srv := newCompressingServer(t, "gzip", &accept)
+	defer srv.Close()
+
+	c := PromMetricsClient{URL: srv.URL + "/metrics"}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accept != "gzip, deflate" {
+		t.Fatal("incorrect Accept-Encoding header", accept)
+	}
+
+	if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+}
+
+func TestGetDeflate(t *testing.T) {
+	var accept string
+	srv := newCompressingServer(t, "deflate", &accept)
+	defer srv.Close()
+
+	c := PromMetricsClient{URL: srv.URL + "/metrics"}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "go_memstats_mallocs_total"); m.Samples[0].Value != 44939 {
+		t.Fatal("incorrect counter value")
+	}
+}
+
+func TestGetCustomDecoder(t *testing.T) {
+	var accept string
+	srv := newCompressingServer(t, "zstd", &accept)
+	defer srv.Close()
+
+	var decoded bool
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		Decoders: map[string]Decoder{
+			"zstd": func(r io.Reader) (io.ReadCloser, error) {
+				decoded = true
+				// the test server compresses with gzip
+				return gzip.NewReader(r)
+			},
+		},
+	}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accept != "gzip, deflate, zstd" {
+		t.Fatal("incorrect Accept-Encoding header", accept)
+	}
+
+	if !decoded {
+		t.Fatal("expected custom decoder to be used")
+	}
+
+	if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+}
+
+func TestGetDisableCompression(t *testing.T) {
+	var accept string
+	srv := newCompressingServer(t, "gzip", &accept)
+	defer srv.Close()
+
+	c := PromMetricsClient{URL: srv.URL + "/metrics", DisableCompression: true}
+
+	if _, err := c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(accept, "gzip") {
+		t.Fatal("expected compression not to be requested")
+	}
+}
+
+func TestGetGzipBodySizeLimit(t *testing.T) {
+	var accept string
+	srv := newCompressingServer(t, "gzip", &accept)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:    srv.URL + "/metrics",
+		Limits: &Limits{MaxBodyBytes: 2048},
+	}
+
+	if _, err := c.GetMetrics(); err == nil {
+		t.Fatal("expected decompressed body to exceed limit")
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-compression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := ioutil.ReadFile("testdata/memstats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(content)
+	zw.Close()
+
+	name := filepath.Join(dir, "memstats.txt.gz")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{name, "testdata/memstats.txt"} {
+		ms, err := ParseFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+			t.Fatal("incorrect gauge value")
+		}
+	}
+}
@@ -0,0 +1,839 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config defaults, as in Prometheus
+const (
+	DefaultScrapeInterval = time.Minute
+	DefaultScrapeTimeout  = 10 * time.Second
+	DefaultMetricsPath    = "/metrics"
+	DefaultScheme         = "http"
+)
+
+// Config is the subset of the Prometheus configuration file that configures
+// scraping.
+type Config struct {
+	GlobalConfig  GlobalConfig    `yaml:"global,omitempty"`
+	ScrapeConfigs []*ScrapeConfig `yaml:"scrape_configs,omitempty"`
+}
+
+// GlobalConfig holds the defaults for every scrape config
+type GlobalConfig struct {
+	// ScrapeInterval defaults to 1m
+	ScrapeInterval Duration `yaml:"scrape_interval,omitempty"`
+	// ScrapeTimeout defaults to 10s
+	ScrapeTimeout Duration `yaml:"scrape_timeout,omitempty"`
+}
+
+// ScrapeConfig configures the scraping of a set of targets, as in the
+// Prometheus scrape_config.
+type ScrapeConfig struct {
+	// JobName is attached to every target as the job label
+	JobName string `yaml:"job_name"`
+	// ScrapeInterval defaults to the global scrape interval
+	ScrapeInterval Duration `yaml:"scrape_interval,omitempty"`
+	// ScrapeTimeout defaults to the global scrape timeout, or the scrape
+	// interval if it is shorter
+	ScrapeTimeout Duration `yaml:"scrape_timeout,omitempty"`
+	// MetricsPath defaults to /metrics
+	MetricsPath string `yaml:"metrics_path,omitempty"`
+	// Scheme is http or https. Defaults to http.
+	Scheme string `yaml:"scheme,omitempty"`
+	// Params are URL parameters added to every scrape. Only the first value of
+	// each parameter is used.
+	Params url.Values `yaml:"params,omitempty"`
+	// HonorLabels keeps scraped labels that conflict with target labels
+	HonorLabels bool `yaml:"honor_labels,omitempty"`
+	// HonorTimestamps keeps the timestamps exposed by targets. Defaults to
+	// true when loaded from YAML.
+	HonorTimestamps bool `yaml:"honor_timestamps"`
+
+	TLSConfig *TLSConfig    `yaml:"tls_config,omitempty"`
+	OAuth2    *OAuth2Config `yaml:"oauth2,omitempty"`
+
+	StaticConfigs []*TargetGroup  `yaml:"static_configs,omitempty"`
+	FileSDConfigs []*FileSDConfig `yaml:"file_sd_configs,omitempty"`
+	HTTPSDConfigs []*HTTPSDConfig `yaml:"http_sd_configs,omitempty"`
+	DNSSDConfigs  []*DNSSDConfig  `yaml:"dns_sd_configs,omitempty"`
+
+	RelabelConfigs       []*RelabelConfig `yaml:"relabel_configs,omitempty"`
+	MetricRelabelConfigs []*RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
+
+	BodySizeLimit         ByteSize `yaml:"body_size_limit,omitempty"`
+	SampleLimit           int      `yaml:"sample_limit,omitempty"`
+	LabelLimit            int      `yaml:"label_limit,omitempty"`
+	LabelNameLengthLimit  int      `yaml:"label_name_length_limit,omitempty"`
+	LabelValueLengthLimit int      `yaml:"label_value_length_limit,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (c *ScrapeConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = ScrapeConfig{HonorTimestamps: true}
+	type plain ScrapeConfig
+	return unmarshal((*plain)(c))
+}
+
+// FileSDConfig configures file based service discovery, see FileSD
+type FileSDConfig struct {
+	Files           []string `yaml:"files"`
+	RefreshInterval Duration `yaml:"refresh_interval,omitempty"`
+}
+
+// HTTPSDConfig configures HTTP based service discovery, see HTTPSD
+type HTTPSDConfig struct {
+	URL             string        `yaml:"url"`
+	RefreshInterval Duration      `yaml:"refresh_interval,omitempty"`
+	TLSConfig       *TLSConfig    `yaml:"tls_config,omitempty"`
+	OAuth2          *OAuth2Config `yaml:"oauth2,omitempty"`
+}
+
+// DNSSDConfig configures DNS based service discovery, see DNSSD
+type DNSSDConfig struct {
+	Names           []string `yaml:"names"`
+	Type            string   `yaml:"type,omitempty"`
+	Port            int      `yaml:"port,omitempty"`
+	RefreshInterval Duration `yaml:"refresh_interval,omitempty"`
+}
+
+// ConfigError is a config validation error
+type ConfigError struct {
+	// Path is the YAML path of the invalid value e.g. scrape_configs[0].job_name
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configErrorf(path, format string, a ...interface{}) error {
+	return &ConfigError{Path: path, Err: fmt.Errorf(format, a...)}
+}
+
+// LoadConfig parses and validates a YAML config. Defaults are set on the
+// returned config. Invalid values are reported as a *ConfigError with the path
+// of the value.
+func LoadConfig(b []byte) (*Config, error) {
+	cfg := Config{}
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		var v interface{}
+		if yaml.Unmarshal(b, &v) == nil {
+			if path, ok := yamlErrorPath(v, reflect.TypeOf(cfg), ""); ok && path != "" {
+				return nil, &ConfigError{Path: path, Err: err}
+			}
+		}
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadConfigFile reads a YAML config from a file. Relative paths in the config
+// are resolved against the directory of the file.
+func LoadConfigFile(name string) (*Config, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	cfg.resolvePaths(filepath.Dir(name))
+	return cfg, nil
+}
+
+// yamlTypes maps types to the types their YAML form is decoded with
+var yamlTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(TLSConfig{}): reflect.TypeOf(tlsConfigYAML{}),
+}
+
+// yamlErrorPath finds the path of the value in a decoded YAML document that
+// fails to decode strictly into type t. It reports false if v decodes.
+func yamlErrorPath(v interface{}, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return path, true
+	}
+	if yaml.UnmarshalStrict(b, reflect.New(t).Interface()) == nil {
+		return "", false
+	}
+	if yt, ok := yamlTypes[t]; ok {
+		t = yt
+	}
+
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		if t.Kind() != reflect.Struct {
+			break
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" || f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f.Type
+		}
+
+		keys := make([]string, 0, len(vv))
+		values := map[string]interface{}{}
+		for k, fv := range vv {
+			ks := fmt.Sprint(k)
+			keys = append(keys, ks)
+			values[ks] = fv
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			ft, ok := fields[k]
+			if !ok {
+				return p, true
+			}
+			if fp, ok := yamlErrorPath(values[k], ft, p); ok {
+				return fp, true
+			}
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice {
+			break
+		}
+		for i, ev := range vv {
+			if ep, ok := yamlErrorPath(ev, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); ok {
+				return ep, true
+			}
+		}
+	}
+	return path, true
+}
+
+func (c *Config) setDefaults() {
+	if c.GlobalConfig.ScrapeInterval == 0 {
+		c.GlobalConfig.ScrapeInterval = Duration(DefaultScrapeInterval)
+	}
+	if c.GlobalConfig.ScrapeTimeout == 0 {
+		c.GlobalConfig.ScrapeTimeout = Duration(DefaultScrapeTimeout)
+		if c.GlobalConfig.ScrapeTimeout > c.GlobalConfig.ScrapeInterval {
+			c.GlobalConfig.ScrapeTimeout = c.GlobalConfig.ScrapeInterval
+		}
+	}
+
+	for _, sc := range c.ScrapeConfigs {
+		if sc == nil {
+			continue
+		}
+		if sc.ScrapeInterval == 0 {
+			sc.ScrapeInterval = c.GlobalConfig.ScrapeInterval
+		}
+		if sc.ScrapeTimeout == 0 {
+			sc.ScrapeTimeout = c.GlobalConfig.ScrapeTimeout
+			if sc.ScrapeTimeout > sc.ScrapeInterval {
+				sc.ScrapeTimeout = sc.ScrapeInterval
+			}
+		}
+		if sc.MetricsPath == "" {
+			sc.MetricsPath = DefaultMetricsPath
+		}
+		if sc.Scheme == "" {
+			sc.Scheme = DefaultScheme
+		}
+	}
+}
+
+func (c *Config) resolvePaths(dir string) {
+	join := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	joinTLS := func(tc *TLSConfig) {
+		if tc != nil {
+			join(&tc.CAFile)
+			join(&tc.CertFile)
+			join(&tc.KeyFile)
+		}
+	}
+	joinOAuth2 := func(oc *OAuth2Config) {
+		if oc != nil {
+			join(&oc.ClientSecretFile)
+		}
+	}
+
+	for _, sc := range c.ScrapeConfigs {
+		joinTLS(sc.TLSConfig)
+		joinOAuth2(sc.OAuth2)
+		for _, fc := range sc.FileSDConfigs {
+			for i := range fc.Files {
+				join(&fc.Files[i])
+			}
+		}
+		for _, hc := range sc.HTTPSDConfigs {
+			joinTLS(hc.TLSConfig)
+			joinOAuth2(hc.OAuth2)
+		}
+	}
+}
+
+// Validate checks the config, returning a *ConfigError for the first invalid
+// value found.
+func (c *Config) Validate() error {
+	if c.GlobalConfig.ScrapeTimeout > c.GlobalConfig.ScrapeInterval {
+		return configErrorf("global.scrape_timeout", "scrape timeout greater than scrape interval")
+	}
+
+	jobs := map[string]bool{}
+	for i, sc := range c.ScrapeConfigs {
+		path := fmt.Sprintf("scrape_configs[%d]", i)
+		if sc == nil {
+			return configErrorf(path, "empty scrape config")
+		}
+		if err := sc.validate(path); err != nil {
+			return err
+		}
+		if jobs[sc.JobName] {
+			return configErrorf(path+".job_name", "found multiple scrape configs with job name %q", sc.JobName)
+		}
+		jobs[sc.JobName] = true
+	}
+	return nil
+}
+
+func (c *ScrapeConfig) validate(path string) error {
+	if c.JobName == "" {
+		return configErrorf(path+".job_name", "job name is required")
+	}
+	if c.ScrapeInterval <= 0 {
+		return configErrorf(path+".scrape_interval", "scrape interval must be greater than zero")
+	}
+	if c.ScrapeTimeout <= 0 {
+		return configErrorf(path+".scrape_timeout", "scrape timeout must be greater than zero")
+	}
+	if c.ScrapeTimeout > c.ScrapeInterval {
+		return configErrorf(path+".scrape_timeout", "scrape timeout greater than scrape interval for job %q", c.JobName)
+	}
+	if !strings.HasPrefix(c.MetricsPath, "/") {
+		return configErrorf(path+".metrics_path", "metrics path must start with /")
+	}
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return configErrorf(path+".scheme", "unsupported scheme %q", c.Scheme)
+	}
+
+	if err := validateTLSConfig(path+".tls_config", c.TLSConfig); err != nil {
+		return err
+	}
+	if err := validateOAuth2Config(path+".oauth2", c.OAuth2); err != nil {
+		return err
+	}
+
+	for i, tg := range c.StaticConfigs {
+		p := fmt.Sprintf("%s.static_configs[%d]", path, i)
+		if tg == nil {
+			return configErrorf(p, "empty static config")
+		}
+		for j, addr := range tg.Targets {
+			if addr == "" || strings.Contains(addr, "/") {
+				return configErrorf(fmt.Sprintf("%s.targets[%d]", p, j), "%q is not a valid host:port", addr)
+			}
+		}
+	}
+
+	for i, fc := range c.FileSDConfigs {
+		p := fmt.Sprintf("%s.file_sd_configs[%d]", path, i)
+		if fc == nil || len(fc.Files) == 0 {
+			return configErrorf(p+".files", "at least one file is required")
+		}
+		for j, f := range fc.Files {
+			ext := strings.ToLower(filepath.Ext(f))
+			if ext != ".json" && ext != ".yml" && ext != ".yaml" {
+				return configErrorf(fmt.Sprintf("%s.files[%d]", p, j), "file %q must be JSON or YAML", f)
+			}
+			if _, err := filepath.Match(f, ""); err != nil {
+				return &ConfigError{Path: fmt.Sprintf("%s.files[%d]", p, j), Err: err}
+			}
+		}
+	}
+
+	for i, hc := range c.HTTPSDConfigs {
+		p := fmt.Sprintf("%s.http_sd_configs[%d]", path, i)
+		if hc == nil {
+			return configErrorf(p, "empty HTTP SD config")
+		}
+		u, err := url.Parse(hc.URL)
+		if err != nil {
+			return &ConfigError{Path: p + ".url", Err: err}
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return configErrorf(p+".url", "URL must be http or https with a host")
+		}
+		if err := validateTLSConfig(p+".tls_config", hc.TLSConfig); err != nil {
+			return err
+		}
+		if err := validateOAuth2Config(p+".oauth2", hc.OAuth2); err != nil {
+			return err
+		}
+	}
+
+	for i, dc := range c.DNSSDConfigs {
+		p := fmt.Sprintf("%s.dns_sd_configs[%d]", path, i)
+		if dc == nil || len(dc.Names) == 0 {
+			return configErrorf(p+".names", "at least one name is required")
+		}
+		switch strings.ToUpper(dc.Type) {
+		case "", DNSTypeSRV:
+		case DNSTypeA, DNSTypeAAAA:
+			if dc.Port <= 0 {
+				return configErrorf(p+".port", "port is required for %s records", dc.Type)
+			}
+		default:
+			return configErrorf(p+".type", "unsupported DNS record type %q", dc.Type)
+		}
+	}
+
+	for i, rc := range c.RelabelConfigs {
+		p := fmt.Sprintf("%s.relabel_configs[%d]", path, i)
+		if rc == nil {
+			return configErrorf(p, "empty relabel config")
+		}
+		if err := rc.Validate(); err != nil {
+			return &ConfigError{Path: p, Err: err}
+		}
+	}
+
+	for i, rc := range c.MetricRelabelConfigs {
+		p := fmt.Sprintf("%s.metric_relabel_configs[%d]", path, i)
+		if rc == nil {
+			return configErrorf(p, "empty relabel config")
+		}
+		if err := rc.Validate(); err != nil {
+			return &ConfigError{Path: p, Err: err}
+		}
+	}
+
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"body_size_limit", int64(c.BodySizeLimit)},
+		{"sample_limit", int64(c.SampleLimit)},
+		{"label_limit", int64(c.LabelLimit)},
+		{"label_name_length_limit", int64(c.LabelNameLengthLimit)},
+		{"label_value_length_limit", int64(c.LabelValueLengthLimit)},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			return configErrorf(path+"."+l.name, "limit must not be negative")
+		}
+	}
+	return nil
+}
+
+func validateTLSConfig(path string, c *TLSConfig) error {
+	if c == nil {
+		return nil
+	}
+	if c.CertFile != "" && c.KeyFile == "" {
+		return configErrorf(path+".key_file", "key file is required when a cert file is set")
+	}
+	if c.KeyFile != "" && c.CertFile == "" {
+		return configErrorf(path+".cert_file", "cert file is required when a key file is set")
+	}
+	return nil
+}
+
+func validateOAuth2Config(path string, c *OAuth2Config) error {
+	if c == nil {
+		return nil
+	}
+	if c.ClientID == "" {
+		return configErrorf(path+".client_id", "client ID is required")
+	}
+	if c.TokenURL == "" {
+		return configErrorf(path+".token_url", "token URL is required")
+	}
+	return nil
+}
+
+// Equal reports whether two scrape configs are the same
+func (c *ScrapeConfig) Equal(o *ScrapeConfig) bool {
+	a, aerr := yaml.Marshal(c)
+	b, berr := yaml.Marshal(o)
+	return aerr == nil && berr == nil && bytes.Equal(a, b)
+}
+
+// Client creates a client that scrapes with the TLS, authentication and limit
+// options of the scrape config.
+func (c *ScrapeConfig) Client() *PromMetricsClient {
+	pc := PromMetricsClient{TLSConfig: c.TLSConfig, OAuth2: c.OAuth2}
+	if c.BodySizeLimit > 0 || c.SampleLimit > 0 || c.LabelLimit > 0 || c.LabelNameLengthLimit > 0 || c.LabelValueLengthLimit > 0 {
+		pc.Limits = &Limits{
+			MaxBodyBytes:        int64(c.BodySizeLimit),
+			MaxSamples:          c.SampleLimit,
+			MaxLabels:           c.LabelLimit,
+			MaxLabelNameLength:  c.LabelNameLengthLimit,
+			MaxLabelValueLength: c.LabelValueLengthLimit,
+		}
+	}
+	return &pc
+}
+
+// Discoverer creates a discoverer for all the targets of the scrape config.
+// The job, __scheme__, __metrics_path__ and __param_<name> labels are set on
+// every target group, unless the group already has them.
+func (c *ScrapeConfig) Discoverer() Discoverer {
+	var ds []Discoverer
+	if len(c.StaticConfigs) > 0 {
+		ds = append(ds, staticDiscoverer(c.StaticConfigs))
+	}
+	for _, fc := range c.FileSDConfigs {
+		ds = append(ds, &FileSD{Files: fc.Files, RefreshInterval: time.Duration(fc.RefreshInterval)})
+	}
+	for _, hc := range c.HTTPSDConfigs {
+		ds = append(ds, &HTTPSD{
+			URL:             hc.URL,
+			RefreshInterval: time.Duration(hc.RefreshInterval),
+			Client:          &PromMetricsClient{TLSConfig: hc.TLSConfig, OAuth2: hc.OAuth2},
+		})
+	}
+	for _, dc := range c.DNSSDConfigs {
+		ds = append(ds, &DNSSD{Names: dc.Names, Type: dc.Type, Port: dc.Port, RefreshInterval: time.Duration(dc.RefreshInterval)})
+	}
+
+	lbs := map[string]string{
+		"job":            c.JobName,
+		SchemeLabel:      c.Scheme,
+		MetricsPathLabel: c.MetricsPath,
+	}
+	for k, vs := range c.Params {
+		if len(vs) > 0 {
+			lbs[ParamLabelPrefix+k] = vs[0]
+		}
+	}
+	return &jobDiscoverer{discoverers: ds, labels: lbs}
+}
+
+// staticDiscoverer sends its target groups once
+type staticDiscoverer []*TargetGroup
+
+func (d staticDiscoverer) Run(ctx context.Context, ch chan<- []*TargetGroup) {
+	tgs := make([]*TargetGroup, len(d))
+	for i, tg := range d {
+		tgs[i] = &TargetGroup{Targets: tg.Targets, Labels: tg.Labels, Source: fmt.Sprintf("static:%d", i)}
+	}
+	select {
+	case ch <- tgs:
+	case <-ctx.Done():
+	}
+}
+
+// jobDiscoverer merges the target groups of many discoverers and adds the job
+// labels to them
+type jobDiscoverer struct {
+	discoverers []Discoverer
+	labels      map[string]string
+}
+
+type discovered struct {
+	index int
+	tgs   []*TargetGroup
+}
+
+func (d *jobDiscoverer) Run(ctx context.Context, ch chan<- []*TargetGroup) {
+	updates := make(chan discovered)
+	for i, sd := range d.discoverers {
+		sdch := make(chan []*TargetGroup)
+		go sd.Run(ctx, sdch)
+		go func(i int, sdch <-chan []*TargetGroup) {
+			for {
+				select {
+				case tgs := <-sdch:
+					select {
+					case updates <- discovered{i, tgs}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(i, sdch)
+	}
+
+	all := make([][]*TargetGroup, len(d.discoverers))
+	for {
+		select {
+		case u := <-updates:
+			all[u.index] = u.tgs
+		case <-ctx.Done():
+			return
+		}
+
+		var tgs []*TargetGroup
+		for _, dtgs := range all {
+			for _, tg := range dtgs {
+				lbs := copyLabels(d.labels)
+				for k, v := range tg.Labels {
+					lbs[k] = v
+				}
+				tgs = append(tgs, &TargetGroup{Targets: tg.Targets, Labels: lbs, Source: tg.Source})
+			}
+		}
+
+		select {
+		case ch <- tgs:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Duration is a duration in the Prometheus format e.g. 1d, 1h30m, 500ms
+type Duration time.Duration
+
+var durationRegex = regexp.MustCompile(`^(([0-9]+)y)?(([0-9]+)w)?(([0-9]+)d)?(([0-9]+)h)?(([0-9]+)m)?(([0-9]+)s)?(([0-9]+)ms)?$`)
+
+var durationUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// ParseDuration parses a duration in the Prometheus format. Units are y, w, d,
+// h, m, s and ms, and must be in that order.
+func ParseDuration(s string) (Duration, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	m := durationRegex.FindStringSubmatch(s)
+	if s == "" || m == nil {
+		return 0, fmt.Errorf("not a valid duration string: %q", s)
+	}
+
+	var d time.Duration
+	for i, u := range durationUnits {
+		v := m[i*2+2]
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a valid duration string: %q", s)
+		}
+		d += time.Duration(n) * u.d
+	}
+	return Duration(d), nil
+}
+
+func (d Duration) String() string {
+	if d == 0 {
+		return "0s"
+	}
+
+	var b strings.Builder
+	rem := time.Duration(d)
+	for _, u := range durationUnits {
+		if n := rem / u.d; n > 0 {
+			b.WriteString(strconv.FormatInt(int64(n), 10))
+			b.WriteString(u.name)
+			rem -= n * u.d
+		}
+	}
+	return b.String()
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	dur, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = dur
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// ByteSize is a number of bytes. In YAML it may have a base 2 unit suffix e.g.
+// 10MB or 10MiB are both 10 * 1024 * 1024 bytes, as in Prometheus.
+type ByteSize int64
+
+var byteSizeRegex = regexp.MustCompile(`^([0-9]+)(B|KB|KiB|MB|MiB|GB|GiB|TB|TiB)?$`)
+
+var byteSizeUnits = []struct {
+	name string
+	n    int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a number of bytes with an optional base 2 unit suffix
+func ParseByteSize(s string) (ByteSize, error) {
+	m := byteSizeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("not a valid byte size: %q", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a valid byte size: %q", s)
+	}
+	unit := strings.Replace(m[2], "iB", "B", 1)
+	for _, u := range byteSizeUnits {
+		if strings.Replace(u.name, "iB", "B", 1) == unit {
+			return ByteSize(n * u.n), nil
+		}
+	}
+	return ByteSize(n), nil
+}
+
+func (b ByteSize) String() string {
+	for _, u := range byteSizeUnits {
+		if b != 0 && int64(b)%u.n == 0 {
+			return strconv.FormatInt(int64(b)/u.n, 10) + u.name
+		}
+	}
+	return "0B"
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	n, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = n
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (b ByteSize) MarshalYAML() (interface{}, error) {
+	return b.String(), nil
+}
+
+// tlsConfigYAML is the YAML form of a TLSConfig, with the minimum TLS version
+// written as in Prometheus configs e.g. TLS12
+type tlsConfigYAML struct {
+	CAFile             string     `yaml:"ca_file,omitempty"`
+	CertFile           string     `yaml:"cert_file,omitempty"`
+	KeyFile            string     `yaml:"key_file,omitempty"`
+	ServerName         string     `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool       `yaml:"insecure_skip_verify,omitempty"`
+	MinVersion         tlsVersion `yaml:"min_version,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (c *TLSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var y tlsConfigYAML
+	if err := unmarshal(&y); err != nil {
+		return err
+	}
+	*c = TLSConfig{
+		CAFile:             y.CAFile,
+		CertFile:           y.CertFile,
+		KeyFile:            y.KeyFile,
+		ServerName:         y.ServerName,
+		InsecureSkipVerify: y.InsecureSkipVerify,
+		MinVersion:         uint16(y.MinVersion),
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (c TLSConfig) MarshalYAML() (interface{}, error) {
+	return tlsConfigYAML{
+		CAFile:             c.CAFile,
+		CertFile:           c.CertFile,
+		KeyFile:            c.KeyFile,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tlsVersion(c.MinVersion),
+	}, nil
+}
+
+// tlsVersion is a TLS protocol version, written in YAML as TLS10 to TLS13
+type tlsVersion uint16
+
+var tlsVersions = map[string]tlsVersion{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (v *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	tv, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("unknown TLS version: %s", s)
+	}
+	*v = tv
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (v tlsVersion) MarshalYAML() (interface{}, error) {
+	for s, tv := range tlsVersions {
+		if tv == v {
+			return s, nil
+		}
+	}
+	return fmt.Sprintf("%#04x", uint16(v)), nil
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	cfg, err := LoadConfigFile("testdata/config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.ScrapeConfigs) != 2 {
+		t.Fatal("incorrect scrape configs length")
+	}
+
+	node := cfg.ScrapeConfigs[0]
+
+	if node.ScrapeInterval != Duration(24*time.Hour) || node.ScrapeTimeout != Duration(DefaultScrapeTimeout) {
+		t.Fatal("incorrect node intervals", node.ScrapeInterval, node.ScrapeTimeout)
+	}
+
+	if node.MetricsPath != "/metrics" || node.Scheme != "http" || !node.HonorTimestamps {
+		t.Fatal("incorrect node defaults")
+	}
+
+	if len(node.StaticConfigs) != 1 || len(node.StaticConfigs[0].Targets) != 2 || node.StaticConfigs[0].Labels["env"] != "prod" {
+		t.Fatal("incorrect static configs")
+	}
+
+	bb := cfg.ScrapeConfigs[1]
+
+	if bb.ScrapeInterval != Duration(30*time.Second) || bb.MetricsPath != "/probe" || bb.Scheme != "https" {
+		t.Fatal("incorrect blackbox config")
+	}
+
+	if bb.Params.Get("module") != "http_2xx" || !bb.HonorLabels || bb.HonorTimestamps {
+		t.Fatal("incorrect blackbox options")
+	}
+
+	if bb.TLSConfig.MinVersion != tls.VersionTLS12 || bb.TLSConfig.CAFile != filepath.Join("testdata", "ca.pem") {
+		t.Fatal("incorrect TLS config", bb.TLSConfig)
+	}
+
+	if bb.OAuth2.ClientSecretFile != filepath.Join("testdata", "secret.txt") || bb.OAuth2.Scopes[0] != "metrics" {
+		t.Fatal("incorrect oauth2 config")
+	}
+
+	if bb.FileSDConfigs[0].Files[0] != filepath.Join("testdata", "targets", "*.json") || bb.FileSDConfigs[0].RefreshInterval != Duration(5*time.Minute) {
+		t.Fatal("incorrect file SD config")
+	}
+
+	if bb.HTTPSDConfigs[0].URL != "https://sd.example.org/targets" || bb.DNSSDConfigs[0].Names[0] != "_metrics._tcp.web.service.consul" {
+		t.Fatal("incorrect SD configs")
+	}
+
+	if len(bb.RelabelConfigs) != 2 || len(bb.MetricRelabelConfigs) != 1 || bb.MetricRelabelConfigs[0].Action != RelabelDrop {
+		t.Fatal("incorrect relabel configs")
+	}
+
+	l := bb.Client().Limits
+	if l.MaxBodyBytes != 10<<20 || l.MaxSamples != 1000 || l.MaxLabels != 30 || l.MaxLabelNameLength != 128 || l.MaxLabelValueLength != 512 {
+		t.Fatal("incorrect limits", l)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		path   string
+	}{
+		{`scrape_configs: [{static_configs: [{targets: [a:80]}]}]`, "scrape_configs[0].job_name"},
+		{`scrape_configs: [{job_name: a}, {job_name: a}]`, "scrape_configs[1].job_name"},
+		{`scrape_configs: [{job_name: a, scrape_interval: 5s, scrape_timeout: 10s}]`, "scrape_configs[0].scrape_timeout"},
+		{`scrape_configs: [{job_name: a, scheme: ftp}]`, "scrape_configs[0].scheme"},
+		{`scrape_configs: [{job_name: a, metrics_path: metrics}]`, "scrape_configs[0].metrics_path"},
+		{`scrape_configs: [{job_name: a, static_configs: [{targets: ['http://a:80']}]}]`, "scrape_configs[0].static_configs[0].targets[0]"},
+		{`scrape_configs: [{job_name: a, file_sd_configs: [{files: [targets.txt]}]}]`, "scrape_configs[0].file_sd_configs[0].files[0]"},
+		{`scrape_configs: [{job_name: a, http_sd_configs: [{url: /targets}]}]`, "scrape_configs[0].http_sd_configs[0].url"},
+		{`scrape_configs: [{job_name: a, dns_sd_configs: [{names: [db], type: A}]}]`, "scrape_configs[0].dns_sd_configs[0].port"},
+		{`scrape_configs: [{job_name: a, tls_config: {cert_file: cert.pem}}]`, "scrape_configs[0].tls_config.key_file"},
+		{`scrape_configs: [{job_name: a, oauth2: {client_id: a}}]`, "scrape_configs[0].oauth2.token_url"},
+		{`scrape_configs: [{job_name: a}, {job_name: b, relabel_configs: [{action: hashmod, target_label: a}]}]`, "scrape_configs[1].relabel_configs[0]"},
+		{`scrape_configs: [{job_name: a, metric_relabel_configs: [{action: keep}, {action: nope}]}]`, "scrape_configs[0].metric_relabel_configs[1]"},
+		{`scrape_configs: [{job_name: a, sample_limit: -1}]`, "scrape_configs[0].sample_limit"},
+	}
+
+	for _, tt := range tests {
+		_, err := LoadConfig([]byte(tt.config))
+
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) {
+			t.Fatal("expected config error for", tt.config, err)
+		}
+
+		if cerr.Path != tt.path {
+			t.Fatal("incorrect config error path", cerr.Path, tt.path)
+		}
+	}
+
+	invalid := []struct {
+		config string
+		path   string
+	}{
+		{`scrape_configs: [{job_name: a, unknown: true}]`, "scrape_configs[0].unknown"},
+		{`scrape_configs: [{job_name: a, scrape_interval: 1x}]`, "scrape_configs[0].scrape_interval"},
+		{`scrape_configs: [{job_name: a, body_size_limit: 10XB}]`, "scrape_configs[0].body_size_limit"},
+		{`scrape_configs: [{job_name: a, tls_config: {min_version: SSL3}}]`, "scrape_configs[0].tls_config.min_version"},
+		{`scrape_configs: [{job_name: a}, {job_name: b, relabel_configs: [{action: keep}, {regex: '('}]}]`, "scrape_configs[1].relabel_configs[1].regex"},
+		{`global: {scrape_interval: [1m]}`, "global.scrape_interval"},
+	}
+
+	for _, tt := range invalid {
+		_, err := LoadConfig([]byte(tt.config))
+
+		var cerr *ConfigError
+		if !errors.As(err, &cerr) {
+			t.Fatal("expected config error for", tt.config, err)
+		}
+
+		if cerr.Path != tt.path {
+			t.Fatal("incorrect parse error path", cerr.Path, tt.path)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Duration
+	}{
+		{"0", 0},
+		{"0s", 0},
+		{"500ms", 500 * time.Millisecond},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"1w", 7 * 24 * time.Hour},
+		{"1y", 365 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDuration(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Duration(d) != tt.out {
+			t.Fatal("incorrect duration for", tt.in)
+		}
+	}
+
+	for _, s := range []string{"", "1", "1.5s", "30m1h"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Fatal("expected invalid duration error for", s)
+		}
+	}
+
+	if s := Duration(8*24*time.Hour + 90*time.Second).String(); s != "1w1d1m30s" {
+		t.Fatal("incorrect duration string", s)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in  string
+		out ByteSize
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"1KB", 1 << 10},
+		{"1KiB", 1 << 10},
+		{"10MB", 10 << 20},
+		{"2GiB", 2 << 30},
+	}
+
+	for _, tt := range tests {
+		b, err := ParseByteSize(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b != tt.out {
+			t.Fatal("incorrect byte size for", tt.in)
+		}
+	}
+
+	if s := ByteSize(10 << 20).String(); s != "10MiB" {
+		t.Fatal("incorrect byte size string", s)
+	}
+}
+
+func TestScrapeConfigDiscoverer(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`
+scrape_configs:
+  - job_name: blackbox
+    metrics_path: /probe
+    params:
+      module: [http_2xx]
+    static_configs:
+      - targets: ['example.org:443']
+      - targets: ['example.com:443']
+        labels:
+          job: override
+    relabel_configs:
+      - source_labels: [__address__]
+        target_label: __param_target
+      - source_labels: [__param_target]
+        target_label: instance
+      - target_label: __address__
+        replacement: blackbox:9115
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := cfg.ScrapeConfigs[0]
+
+	ch := make(chan []*TargetGroup)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sc.Discoverer().Run(ctx, ch)
+
+	ts := TargetsFromGroups(receiveGroups(t, ch), sc.RelabelConfigs...)
+
+	if len(ts) != 2 {
+		t.Fatal("incorrect targets length")
+	}
+
+	if ts[0].URL != "http://blackbox:9115/probe?module=http_2xx&target=example.org%3A443" {
+		t.Fatal("incorrect target URL", ts[0].URL)
+	}
+
+	if ts[0].Labels["job"] != "blackbox" || ts[0].Labels["instance"] != "example.org:443" {
+		t.Fatal("incorrect target labels", ts[0].Labels)
+	}
+
+	if ts[1].Labels["job"] != "override" {
+		t.Fatal("expected group labels to override job labels")
+	}
+}
+
+func TestScrapeConfigEqual(t *testing.T) {
+	load := func(s string) *ScrapeConfig {
+		cfg, err := LoadConfig([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg.ScrapeConfigs[0]
+	}
+
+	a := load(`scrape_configs: [{job_name: a, relabel_configs: [{regex: 'a.*', action: keep, source_labels: [b]}]}]`)
+	b := load(`scrape_configs: [{job_name: a, relabel_configs: [{regex: 'a.*', action: keep, source_labels: [b]}]}]`)
+	c := load(`scrape_configs: [{job_name: a, relabel_configs: [{regex: 'b.*', action: keep, source_labels: [b]}]}]`)
+
+	if !a.Equal(b) {
+		t.Fatal("expected configs to be equal")
+	}
+
+	if a.Equal(c) {
+		t.Fatal("expected configs not to be equal")
+	}
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Labels set on discovered targets that control how they are scraped. Labels
+// starting with "__" are removed from the target once it has been created.
+const (
+	AddressLabel     = "__address__"
+	SchemeLabel      = "__scheme__"
+	MetricsPathLabel = "__metrics_path__"
+	// ParamLabelPrefix is the prefix of labels that set URL parameters e.g.
+	// __param_module sets the module parameter
+	ParamLabelPrefix = "__param_"
+)
+
+// TargetGroup is a set of targets that share labels, as provided by service
+// discovery.
+type TargetGroup struct {
+	// Targets are the addresses (host:port) of the targets
+	Targets []string `json:"targets" yaml:"targets"`
+	// Labels are attached to every target in the group
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Source identifies where the group came from e.g. the file it was read from
+	Source string `json:"-" yaml:"-"`
+}
+
+// Discoverer discovers target groups.
+type Discoverer interface {
+	// Run sends the full set of target groups on ch each time it changes,
+	// until the context is done.
+	Run(ctx context.Context, ch chan<- []*TargetGroup)
+}
+
+// TargetsFromGroups creates scrape targets from target groups. The URL of each
+// target is built from its __scheme__, __address__ and __metrics_path__
+// labels, which default to "http", the target address and "/metrics", and
+// its __param_<name> labels, which set URL parameters. The relabel configs are
+// applied to the labels of each target before it is created, targets that are
+// dropped are skipped. The instance label defaults to the address.
+func TargetsFromGroups(tgs []*TargetGroup, cfgs ...*RelabelConfig) []*Target {
+	var ts []*Target
+	for _, tg := range tgs {
+		for _, addr := range tg.Targets {
+			lbs := copyLabels(tg.Labels)
+			lbs[AddressLabel] = addr
+			if _, ok := lbs[SchemeLabel]; !ok {
+				lbs[SchemeLabel] = "http"
+			}
+			if _, ok := lbs[MetricsPathLabel]; !ok {
+				lbs[MetricsPathLabel] = "/metrics"
+			}
+
+			lbs, ok := Relabel(lbs, cfgs)
+			if !ok {
+				continue
+			}
+			if t := targetFromLabels(lbs); t != nil {
+				ts = append(ts, t)
+			}
+		}
+	}
+	return ts
+}
+
+// targetFromLabels creates a target from a discovered label set, returning
+// nil if it has no address.
+func targetFromLabels(lbs map[string]string) *Target {
+	addr := lbs[AddressLabel]
+	if addr == "" {
+		return nil
+	}
+
+	scheme := lbs[SchemeLabel]
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	path := lbs[MetricsPathLabel]
+	if path == "" {
+		path = "/metrics"
+	}
+
+	q := url.Values{}
+	for k, v := range lbs {
+		if strings.HasPrefix(k, ParamLabelPrefix) {
+			q.Set(k[len(ParamLabelPrefix):], v)
+		}
+	}
+
+	u := url.URL{Scheme: scheme, Host: addr, Path: path, RawQuery: q.Encode()}
+
+	t := Target{URL: u.String(), Labels: map[string]string{}}
+	for k, v := range lbs {
+		if !strings.HasPrefix(k, "__") {
+			t.Labels[k] = v
+		}
+	}
+	if _, ok := t.Labels["instance"]; !ok {
+		t.Labels["instance"] = addr
+	}
+	return &t
+}
+
+// Discover runs the discoverer, reloading the manager with the discovered
+// targets each time they change. The manager's RelabelConfigs are applied to
+// the discovered targets. It blocks until the context is done.
+func (m *ScrapeManager) Discover(ctx context.Context, d Discoverer) {
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	for {
+		select {
+		case tgs := <-ch:
+			m.Reload(TargetsFromGroups(tgs, m.RelabelConfigs...))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// attachTargetLabels adds the target labels to every sample. If a sample
+// already has a label with the same name and honor is true the scraped value
+// is kept, otherwise it is renamed to exported_<name> and the target value is
+// used. Labels with an empty value are removed.
+func attachTargetLabels(ms []*Metric, lbs map[string]string, honor bool) {
+	if len(lbs) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(lbs))
+	for k := range lbs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, m := range ms {
+		for _, s := range m.Samples {
+			if s.Labels == nil {
+				s.Labels = map[string]string{}
+			}
+
+			var conflicts []string
+			exported := map[string]string{}
+			for _, k := range names {
+				v, ok := s.Labels[k]
+				if ok && v != "" {
+					if honor {
+						continue
+					}
+					conflicts = append(conflicts, k)
+					exported[k] = v
+				}
+				setLabel(s.Labels, k, lbs[k])
+			}
+
+			// shortest names first so that exported_a is taken before
+			// exported_exported_a, as in Prometheus
+			sort.SliceStable(conflicts, func(i, j int) bool {
+				return len(conflicts[i]) < len(conflicts[j])
+			})
+			for _, k := range conflicts {
+				name := "exported_" + k
+				for s.Labels[name] != "" {
+					name = "exported_" + name
+				}
+				s.Labels[name] = exported[k]
+			}
+		}
+	}
+}
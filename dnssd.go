@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultDNSSDRefreshInterval = 30 * time.Second
+
+// Labels set on targets discovered by DNSSD
+const (
+	DNSNameLabel      = "__meta_dns_name"
+	DNSSRVTargetLabel = "__meta_dns_srv_record_target"
+	DNSSRVPortLabel   = "__meta_dns_srv_record_port"
+)
+
+// DNS record types that can be queried by DNSSD
+const (
+	DNSTypeSRV  = "SRV"
+	DNSTypeA    = "A"
+	DNSTypeAAAA = "AAAA"
+)
+
+// DNSResolver resolves DNS records. It is satisfied by *net.Resolver.
+type DNSResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DNSSD discovers targets by periodically resolving DNS names, in the same way
+// as the Prometheus dns_sd_configs. Each resolved record becomes a target
+// group with a single target.
+type DNSSD struct {
+	// Names are the DNS names to resolve
+	Names []string
+	// Type is the record type to query: SRV, A or AAAA. Defaults to SRV.
+	Type string
+	// Port is the port used for A and AAAA records
+	Port int
+	// RefreshInterval is how often names are resolved. Defaults to 30s.
+	RefreshInterval time.Duration
+	// Resolver is used to resolve names. Defaults to net.DefaultResolver.
+	Resolver DNSResolver
+}
+
+// Refresh resolves every name, returning the target groups for the names that
+// were resolved and an error for the first name that failed.
+func (d *DNSSD) Refresh(ctx context.Context) ([]*TargetGroup, error) {
+	tgs, errs := d.refresh(ctx, nil)
+	for _, name := range d.Names {
+		if err, ok := errs[name]; ok {
+			return tgs, err
+		}
+	}
+	return tgs, nil
+}
+
+// Run implements Discoverer. If a name can't be resolved the groups last
+// resolved for it are kept.
+func (d *DNSSD) Run(ctx context.Context, ch chan<- []*TargetGroup) {
+	interval := d.RefreshInterval
+	if interval <= 0 {
+		interval = defaultDNSSDRefreshInterval
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	names := map[string][]*TargetGroup{}
+	var last []*TargetGroup
+	for {
+		tgs, _ := d.refresh(ctx, names)
+		if last == nil || !reflect.DeepEqual(tgs, last) {
+			last = tgs
+			select {
+			case ch <- tgs:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh resolves every name. If last is not nil it is updated with the
+// groups resolved for each name, and used in place of names that failed.
+func (d *DNSSD) refresh(ctx context.Context, last map[string][]*TargetGroup) ([]*TargetGroup, map[string]error) {
+	tgs := []*TargetGroup{}
+	errs := map[string]error{}
+
+	for _, name := range d.Names {
+		ntgs, err := d.resolve(ctx, name)
+		if err != nil {
+			errs[name] = err
+			if last != nil {
+				tgs = append(tgs, last[name]...)
+			}
+			continue
+		}
+		if last != nil {
+			last[name] = ntgs
+		}
+		tgs = append(tgs, ntgs...)
+	}
+	return tgs, errs
+}
+
+// resolve looks up the records for a name and creates a target group for each
+func (d *DNSSD) resolve(ctx context.Context, name string) ([]*TargetGroup, error) {
+	r := d.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	var addrs []string
+	var lbs []map[string]string
+
+	switch typ := strings.ToUpper(d.Type); typ {
+	case "", DNSTypeSRV:
+		_, srvs, err := r.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup SRV records for %s: %w", name, err)
+		}
+		sort.Slice(srvs, func(i, j int) bool {
+			if srvs[i].Target != srvs[j].Target {
+				return srvs[i].Target < srvs[j].Target
+			}
+			return srvs[i].Port < srvs[j].Port
+		})
+		for _, srv := range srvs {
+			target := strings.TrimSuffix(srv.Target, ".")
+			port := strconv.Itoa(int(srv.Port))
+			addrs = append(addrs, net.JoinHostPort(target, port))
+			lbs = append(lbs, map[string]string{
+				DNSNameLabel:      name,
+				DNSSRVTargetLabel: srv.Target,
+				DNSSRVPortLabel:   port,
+			})
+		}
+	case DNSTypeA, DNSTypeAAAA:
+		if d.Port <= 0 {
+			return nil, fmt.Errorf("port is required for %s records", typ)
+		}
+		ips, err := r.LookupIPAddr(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup %s records for %s: %w", typ, name, err)
+		}
+		sort.Slice(ips, func(i, j int) bool { return ips[i].String() < ips[j].String() })
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) != (typ == DNSTypeA) {
+				continue
+			}
+			addrs = append(addrs, net.JoinHostPort(ip.String(), strconv.Itoa(d.Port)))
+			lbs = append(lbs, map[string]string{DNSNameLabel: name})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DNS record type %q", d.Type)
+	}
+
+	tgs := make([]*TargetGroup, 0, len(addrs))
+	for i, addr := range addrs {
+		tgs = append(tgs, &TargetGroup{
+			Targets: []string{addr},
+			Labels:  lbs[i],
+			Source:  fmt.Sprintf("%s:%d", name, i),
+		})
+	}
+	return tgs, nil
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubResolver struct {
+	mu   sync.Mutex
+	srvs map[string][]*net.SRV
+	ips  map[string][]net.IPAddr
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	srvs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, append([]*net.SRV{}, srvs...), nil
+}
+
+func (r *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return append([]net.IPAddr{}, ips...), nil
+}
+
+func (r *stubResolver) setSRV(name string, srvs []*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if srvs == nil {
+		delete(r.srvs, name)
+		return
+	}
+	r.srvs[name] = srvs
+}
+
+func TestDNSSDSRV(t *testing.T) {
+	r := &stubResolver{srvs: map[string][]*net.SRV{
+		"_metrics._tcp.web.service.consul": {
+			{Target: "web-2.node.consul.", Port: 8080},
+			{Target: "web-1.node.consul.", Port: 8080},
+		},
+	}}
+
+	d := DNSSD{
+		Names:           []string{"_metrics._tcp.web.service.consul"},
+		RefreshInterval: 10 * time.Millisecond,
+		Resolver:        r,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	tgs := receiveGroups(t, ch)
+
+	if len(tgs) != 2 {
+		t.Fatal("incorrect target groups length")
+	}
+
+	if tgs[0].Targets[0] != "web-1.node.consul:8080" {
+		t.Fatal("incorrect target", tgs[0].Targets[0])
+	}
+
+	if tgs[0].Labels[DNSNameLabel] != "_metrics._tcp.web.service.consul" ||
+		tgs[0].Labels[DNSSRVTargetLabel] != "web-1.node.consul." ||
+		tgs[0].Labels[DNSSRVPortLabel] != "8080" {
+		t.Fatal("incorrect labels", tgs[0].Labels)
+	}
+
+	// a failed lookup keeps the last resolved groups
+	r.setSRV("_metrics._tcp.web.service.consul", nil)
+
+	select {
+	case <-ch:
+		t.Fatal("expected failed lookup to keep last target groups")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.setSRV("_metrics._tcp.web.service.consul", []*net.SRV{{Target: "web-3.node.consul.", Port: 9090}})
+
+	tgs = receiveGroups(t, ch)
+
+	if len(tgs) != 1 || tgs[0].Targets[0] != "web-3.node.consul:9090" {
+		t.Fatal("incorrect target groups")
+	}
+}
+
+func TestDNSSDA(t *testing.T) {
+	r := &stubResolver{ips: map[string][]net.IPAddr{
+		"db.example.org": {
+			{IP: net.ParseIP("10.0.0.2")},
+			{IP: net.ParseIP("2001:db8::1")},
+			{IP: net.ParseIP("10.0.0.1")},
+		},
+	}}
+
+	d := DNSSD{Names: []string{"db.example.org"}, Type: "A", Port: 9187, Resolver: r}
+
+	tgs, err := d.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := TargetsFromGroups(tgs)
+
+	if len(ts) != 2 || ts[0].URL != "http://10.0.0.1:9187/metrics" || ts[1].URL != "http://10.0.0.2:9187/metrics" {
+		t.Fatal("incorrect targets")
+	}
+
+	d.Type = "AAAA"
+
+	tgs, err = d.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tgs) != 1 || tgs[0].Targets[0] != "[2001:db8::1]:9187" {
+		t.Fatal("incorrect target groups")
+	}
+}
+
+func TestDNSSDRefreshErrors(t *testing.T) {
+	r := &stubResolver{}
+
+	d := DNSSD{Names: []string{"missing.example.org"}, Resolver: r}
+
+	_, err := d.Refresh(context.Background())
+
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Fatal("expected DNS error")
+	}
+
+	d = DNSSD{Names: []string{"db.example.org"}, Type: "A", Resolver: r}
+	if _, err := d.Refresh(context.Background()); err == nil {
+		t.Fatal("expected missing port error")
+	}
+
+	d = DNSSD{Names: []string{"db.example.org"}, Type: "MX", Resolver: r}
+	if _, err := d.Refresh(context.Background()); err == nil {
+		t.Fatal("expected unsupported type error")
+	}
+}
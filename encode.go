@@ -0,0 +1,71 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Encode writes metrics in the Prometheus text exposition format, escaping
+// label values and descriptions.
+func Encode(w io.Writer, ms []*Metric) error {
+	bw := bufio.NewWriter(w)
+
+	for _, m := range ms {
+		if m.Description != "" {
+			bw.WriteString("# HELP " + m.Name + " " + helpEscaper.Replace(m.Description) + "\n")
+		}
+		if m.Type != Untyped {
+			bw.WriteString("# TYPE " + m.Name + " " + string(m.Type) + "\n")
+		}
+		for _, s := range m.Samples {
+			writeSample(bw, s)
+		}
+	}
+
+	return bw.Flush()
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func writeSample(w *bufio.Writer, s *Sample) {
+	w.WriteString(s.Name)
+
+	if len(s.Labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range LabelsFromMap(s.Labels) {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l.Name + "=\"" + labelValueEscaper.Replace(l.Value) + "\"")
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(s.Value))
+
+	if s.Timestamp != 0 {
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatInt(s.Timestamp, 10))
+	}
+
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
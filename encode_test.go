@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/example.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := Parse(bytes.NewBuffer(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	rms, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rms) != len(ms) {
+		t.Fatal("incorrect metrics length")
+	}
+
+	for i, m := range ms {
+		rm := rms[i]
+		if rm.Name != m.Name || rm.Description != m.Description || rm.Type != m.Type {
+			t.Fatal("incorrect metric", rm.Name)
+		}
+
+		if len(rm.Samples) != len(m.Samples) {
+			t.Fatal("incorrect samples length", rm.Name)
+		}
+
+		for j, s := range m.Samples {
+			rs := rm.Samples[j]
+			if rs.Name != s.Name || rs.Value != s.Value || rs.Timestamp != s.Timestamp || !LabelsFromMap(rs.Labels).Equal(LabelsFromMap(s.Labels)) {
+				t.Fatal("incorrect sample", rs.Name)
+			}
+		}
+	}
+}
+
+func TestEncodeSample(t *testing.T) {
+	ms := []*Metric{{
+		Name:        "queue_depth",
+		Description: "Depth of the queue.",
+		Type:        GaugeType,
+		Samples: []*Sample{
+			{Name: "queue_depth", Labels: map[string]string{"queue": "b", "host": "a"}, Value: 1.5, Timestamp: 1395066363000},
+			{Name: "queue_depth", Value: math.Inf(-1)},
+		},
+	}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP queue_depth Depth of the queue.
+# TYPE queue_depth gauge
+queue_depth{host="a",queue="b"} 1.5 1395066363000
+queue_depth -Inf
+`
+
+	if buf.String() != expected {
+		t.Fatal("incorrect encoding", buf.String())
+	}
+}
+
+func TestEncodeEscaping(t *testing.T) {
+	ms := []*Metric{{
+		Name:        "file_errors",
+		Description: "Errors for a path\nsuch as C:\\DIR, or \"quoted\".",
+		Type:        CounterType,
+		Samples: []*Sample{{
+			Name: "file_errors",
+			Labels: map[string]string{
+				"path":  `C:\DIR\`,
+				"error": "Cannot find file:\n\"FILE.TXT\"",
+			},
+			Value: 1,
+		}},
+	}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP file_errors Errors for a path\nsuch as C:\\DIR, or "quoted".
+# TYPE file_errors counter
+file_errors{error="Cannot find file:\n\"FILE.TXT\"",path="C:\\DIR\\"} 1
+`
+
+	if buf.String() != expected {
+		t.Fatal("incorrect encoding", buf.String())
+	}
+
+	rms, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rms) != 1 || rms[0].Description != ms[0].Description {
+		t.Fatal("incorrect description", rms[0].Description)
+	}
+
+	if !LabelsFromMap(rms[0].Samples[0].Labels).Equal(LabelsFromMap(ms[0].Samples[0].Labels)) {
+		t.Fatal("incorrect labels", rms[0].Samples[0].Labels)
+	}
+}
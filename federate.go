@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Federator reads series from the /federate endpoint of a Prometheus server.
+type Federator struct {
+	// URL is the base URL of the Prometheus server e.g. http://localhost:9090
+	URL string
+	// Client is used for requests, its URL is ignored. It provides TLS,
+	// authentication, retry and limit options. Defaults to a client with no
+	// options set.
+	Client *PromMetricsClient
+}
+
+// Federate returns the series selected by the match[] selectors e.g.
+// `{job="node"}`. Families that appear more than once in the response are
+// merged. Samples carry the timestamp reported by the server.
+func (f *Federator) Federate(ctx context.Context, matchers ...string) ([]*Metric, error) {
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("at least one match[] selector is required")
+	}
+
+	q := url.Values{}
+	for _, m := range matchers {
+		q.Add("match[]", m)
+	}
+
+	c := f.Client
+	if c == nil {
+		c = defaultClient
+	}
+
+	ms, _, err := c.fetch(ctx, strings.TrimSuffix(f.URL, "/")+"/federate?"+q.Encode(), c.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return mergeMetrics(ms), nil
+}
+
+// mergeMetrics merges metrics with the same name into a single family, in the
+// order they first appear. The first non-empty description and type is kept.
+func mergeMetrics(ms []*Metric) []*Metric {
+	var merged []*Metric
+	byName := map[string]*Metric{}
+
+	for _, m := range ms {
+		mm, ok := byName[m.Name]
+		if !ok {
+			mm = &Metric{Name: m.Name}
+			byName[m.Name] = mm
+			merged = append(merged, mm)
+		}
+		if mm.Description == "" {
+			mm.Description = m.Description
+		}
+		if mm.Type == Untyped {
+			mm.Type = m.Type
+		}
+		mm.Samples = append(mm.Samples, m.Samples...)
+	}
+
+	return merged
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFederate(t *testing.T) {
+	var matches []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/federate" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		matches = req.URL.Query()["match[]"]
+		http.ServeFile(w, req, "testdata/federate.txt")
+	}))
+	defer srv.Close()
+
+	f := Federator{URL: srv.URL + "/"}
+
+	ms, err := f.Federate(context.Background(), `{job="web"}`, `up`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 2 || matches[0] != `{job="web"}` || matches[1] != "up" {
+		t.Fatal("incorrect match[] selectors", matches)
+	}
+
+	if len(ms) != 2 {
+		t.Fatal("expected families to be merged")
+	}
+
+	m := findMetric(t, ms, "http_requests_total")
+
+	if m.Type != CounterType {
+		t.Fatal("incorrect type")
+	}
+
+	if len(m.Samples) != 2 {
+		t.Fatal("incorrect samples length")
+	}
+
+	if m.Samples[1].Labels["instance"] != "web-2:8080" || m.Samples[1].Timestamp != 1600000000500 {
+		t.Fatal("incorrect sample")
+	}
+
+	m = findMetric(t, ms, "up")
+
+	if m.Type != "untyped" {
+		t.Fatal("incorrect type")
+	}
+
+	if len(m.Samples) != 2 || m.Samples[0].Timestamp != 1600000000000 {
+		t.Fatal("incorrect samples")
+	}
+
+	if _, err := f.Federate(context.Background()); err == nil {
+		t.Fatal("expected missing selector error")
+	}
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultFileSDRefreshInterval = 10 * time.Second
+
+// FileSD discovers targets from files in the Prometheus file_sd_configs
+// format: a JSON or YAML list of target groups. Files are watched for changes
+// by polling their modification time and size.
+type FileSD struct {
+	// Files are paths or glob patterns of files to read. Files ending in .json
+	// are read as JSON, .yml and .yaml as YAML.
+	Files []string
+	// RefreshInterval is how often files are checked for changes. Defaults to 10s.
+	RefreshInterval time.Duration
+}
+
+// fileSDState is the last read state of a discovered file
+type fileSDState struct {
+	modTime time.Time
+	size    int64
+	groups  []*TargetGroup
+}
+
+// Run implements Discoverer. If a file can't be read or parsed the groups
+// last read from it are kept.
+func (d *FileSD) Run(ctx context.Context, ch chan<- []*TargetGroup) {
+	interval := d.RefreshInterval
+	if interval <= 0 {
+		interval = defaultFileSDRefreshInterval
+	}
+
+	files := map[string]*fileSDState{}
+	first := true
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if d.refresh(files) || first {
+			first = false
+			select {
+			case ch <- d.groups(files):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh re-reads files that have changed, returning true if any did
+func (d *FileSD) refresh(files map[string]*fileSDState) bool {
+	var changed bool
+	seen := map[string]bool{}
+
+	for _, pattern := range d.Files {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, p := range paths {
+			seen[p] = true
+
+			fi, err := os.Stat(p)
+			if err != nil {
+				continue
+			}
+
+			st, ok := files[p]
+			if ok && st.modTime.Equal(fi.ModTime()) && st.size == fi.Size() {
+				continue
+			}
+
+			tgs, err := readFileSD(p)
+			if err != nil {
+				continue
+			}
+
+			files[p] = &fileSDState{modTime: fi.ModTime(), size: fi.Size(), groups: tgs}
+			changed = true
+		}
+	}
+
+	for p := range files {
+		if !seen[p] {
+			delete(files, p)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (d *FileSD) groups(files map[string]*fileSDState) []*TargetGroup {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	tgs := []*TargetGroup{}
+	for _, p := range paths {
+		tgs = append(tgs, files[p].groups...)
+	}
+	return tgs
+}
+
+// readFileSD reads the target groups from a file_sd file
+func readFileSD(name string) ([]*TargetGroup, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var tgs []*TargetGroup
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		err = json.Unmarshal(b, &tgs)
+	case ".yml", ".yaml":
+		err = yaml.UnmarshalStrict(b, &tgs)
+	default:
+		return nil, fmt.Errorf("unsupported file_sd file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	for i, tg := range tgs {
+		if tg == nil {
+			return nil, fmt.Errorf("failed to parse %s: empty target group at index %d", name, i)
+		}
+		tg.Source = fmt.Sprintf("%s:%d", name, i)
+	}
+	return tgs, nil
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func receiveGroups(t *testing.T, ch <-chan []*TargetGroup) []*TargetGroup {
+	select {
+	case tgs := <-ch:
+		return tgs
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for target groups")
+	}
+	return nil
+}
+
+func TestFileSD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-filesd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTextfiles(t, dir, map[string]string{
+		"web.json": `[{"targets": ["web-1:8080", "web-2:8080"], "labels": {"job": "web", "env": "prod"}}]`,
+		"db.yml": `- targets: ['db-1:9187']
+  labels:
+    job: db
+    __metrics_path__: /probe
+`,
+		"ignored.txt": `[]`,
+	})
+
+	d := FileSD{
+		Files:           []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")},
+		RefreshInterval: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	tgs := receiveGroups(t, ch)
+
+	if len(tgs) != 2 {
+		t.Fatal("incorrect target groups length")
+	}
+
+	if tgs[0].Source != filepath.Join(dir, "db.yml")+":0" {
+		t.Fatal("incorrect source", tgs[0].Source)
+	}
+
+	ts := TargetsFromGroups(tgs)
+
+	if len(ts) != 3 {
+		t.Fatal("incorrect targets length")
+	}
+
+	if ts[0].URL != "http://db-1:9187/probe" {
+		t.Fatal("incorrect target URL", ts[0].URL)
+	}
+
+	if _, ok := ts[0].Labels[MetricsPathLabel]; ok {
+		t.Fatal("expected internal labels to be removed")
+	}
+
+	if ts[1].URL != "http://web-1:8080/metrics" || ts[1].Labels["env"] != "prod" || ts[1].Labels["instance"] != "web-1:8080" {
+		t.Fatal("incorrect target", ts[1])
+	}
+
+	// make sure the modification time changes
+	time.Sleep(10 * time.Millisecond)
+	writeTextfiles(t, dir, map[string]string{
+		"web.json": `[{"targets": ["web-3:8080"], "labels": {"job": "web"}}]`,
+	})
+
+	tgs = receiveGroups(t, ch)
+	ts = TargetsFromGroups(tgs)
+
+	if len(ts) != 2 || ts[1].URL != "http://web-3:8080/metrics" {
+		t.Fatal("expected changed file to be reloaded")
+	}
+
+	// an invalid file keeps its last good groups
+	writeTextfiles(t, dir, map[string]string{"web.json": `[{"targets": `})
+	os.Remove(filepath.Join(dir, "db.yml"))
+
+	tgs = receiveGroups(t, ch)
+
+	if len(tgs) != 1 || tgs[0].Targets[0] != "web-3:8080" {
+		t.Fatal("expected last good groups to be kept")
+	}
+}
+
+func TestScrapeAttachesTargetLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/multisample.txt")
+	}))
+	defer srv.Close()
+
+	ts := TargetsFromGroups([]*TargetGroup{{
+		Targets: []string{strings.TrimPrefix(srv.URL, "http://")},
+		Labels:  map[string]string{"job": "hydra", "peer_id": "ignored"},
+	}})
+
+	s := Scraper{Targets: ts}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+	if rs[0].Err != nil {
+		t.Fatal(rs[0].Err)
+	}
+
+	m := findMetric(t, rs[0].Metrics, "hydrabooster_connected_peers")
+	for _, s := range m.Samples {
+		if s.Labels["job"] != "hydra" || s.Labels["instance"] != ts[0].Labels["instance"] {
+			t.Fatal("expected target labels to be attached")
+		}
+		if s.Labels["peer_id"] != "ignored" || s.Labels["exported_peer_id"] == "" {
+			t.Fatal("expected conflicting scraped label to be exported")
+		}
+	}
+}
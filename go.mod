@@ -1,3 +1,5 @@
 module github.com/alanshaw/prom-metrics-client
 
 go 1.14
+
+require gopkg.in/yaml.v2 v2.4.0
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthState is the health of a target as of its last scrape
+type HealthState string
+
+const (
+	// HealthUnknown is the health of a target that has not been scraped yet
+	HealthUnknown HealthState = "unknown"
+	// HealthUp is the health of a target whose last scrape succeeded
+	HealthUp HealthState = "up"
+	// HealthDown is the health of a target whose last scrape failed
+	HealthDown HealthState = "down"
+)
+
+const defaultMaxErrorHistory = 10
+
+// TargetError is an error from a scrape of a target
+type TargetError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// TargetHealth is the scrape health of a target.
+type TargetHealth struct {
+	Target             *Target
+	Health             HealthState
+	LastScrape         time.Time
+	LastScrapeDuration time.Duration
+	// LastError is the error from the last scrape, or nil if it succeeded
+	LastError           error
+	ConsecutiveFailures int
+	// RecentErrors are the most recent scrape errors, oldest first
+	RecentErrors []TargetError
+}
+
+// HealthRegistry records the health of scraped targets. Set it on
+// ScrapeOptions to record the result of every scrape. The zero value is ready
+// to use.
+type HealthRegistry struct {
+	// MaxErrorHistory is the number of recent errors kept per target. Defaults to 10.
+	MaxErrorHistory int
+
+	mu      sync.Mutex
+	targets map[string]*TargetHealth
+}
+
+func (h *HealthRegistry) get(t *Target) *TargetHealth {
+	if h.targets == nil {
+		h.targets = map[string]*TargetHealth{}
+	}
+	k := targetKey(t)
+	th, ok := h.targets[k]
+	if !ok {
+		th = &TargetHealth{Target: t, Health: HealthUnknown}
+		h.targets[k] = th
+	}
+	return th
+}
+
+// Register adds a target in the unknown state, if it is not already present
+func (h *HealthRegistry) Register(t *Target) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.get(t)
+}
+
+// Remove removes a target from the registry
+func (h *HealthRegistry) Remove(t *Target) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.targets, targetKey(t))
+}
+
+// Record updates the health of the scraped target
+func (h *HealthRegistry) Record(r *ScrapeResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th := h.get(r.Target)
+	th.LastScrape = r.Time
+	th.LastScrapeDuration = r.Duration
+	th.LastError = r.Err
+
+	if r.Err == nil {
+		th.Health = HealthUp
+		th.ConsecutiveFailures = 0
+		return
+	}
+
+	th.Health = HealthDown
+	th.ConsecutiveFailures++
+
+	max := h.MaxErrorHistory
+	if max <= 0 {
+		max = defaultMaxErrorHistory
+	}
+	th.RecentErrors = append(th.RecentErrors, TargetError{Time: r.Time, Error: r.Err.Error()})
+	if len(th.RecentErrors) > max {
+		th.RecentErrors = th.RecentErrors[len(th.RecentErrors)-max:]
+	}
+}
+
+// Get returns the health of the target
+func (h *HealthRegistry) Get(t *Target) (TargetHealth, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	th, ok := h.targets[targetKey(t)]
+	if !ok {
+		return TargetHealth{}, false
+	}
+	return th.copy(), true
+}
+
+// Targets returns the health of all targets, ordered by URL
+func (h *HealthRegistry) Targets() []TargetHealth {
+	h.mu.Lock()
+	ths := make([]TargetHealth, 0, len(h.targets))
+	for _, th := range h.targets {
+		ths = append(ths, th.copy())
+	}
+	h.mu.Unlock()
+
+	sort.Slice(ths, func(i, j int) bool {
+		return targetKey(ths[i].Target) < targetKey(ths[j].Target)
+	})
+	return ths
+}
+
+func (th *TargetHealth) copy() TargetHealth {
+	c := *th
+	c.RecentErrors = append([]TargetError(nil), th.RecentErrors...)
+	return c
+}
+
+type targetHealthJSON struct {
+	Labels              map[string]string `json:"labels"`
+	ScrapePool          string            `json:"scrapePool"`
+	ScrapeURL           string            `json:"scrapeUrl"`
+	LastError           string            `json:"lastError"`
+	LastScrape          time.Time         `json:"lastScrape"`
+	LastScrapeDuration  float64           `json:"lastScrapeDuration"`
+	Health              HealthState       `json:"health"`
+	ConsecutiveFailures int               `json:"consecutiveFailures"`
+	RecentErrors        []TargetError     `json:"recentErrors"`
+}
+
+// MarshalJSON encodes the health of all targets in the format of the
+// Prometheus /api/v1/targets API.
+func (h *HealthRegistry) MarshalJSON() ([]byte, error) {
+	active := []targetHealthJSON{}
+	for _, th := range h.Targets() {
+		lbs := map[string]string{"instance": targetInstance(th.Target)}
+		for k, v := range th.Target.Labels {
+			lbs[k] = v
+		}
+
+		var lastErr string
+		if th.LastError != nil {
+			lastErr = th.LastError.Error()
+		}
+
+		errs := th.RecentErrors
+		if errs == nil {
+			errs = []TargetError{}
+		}
+
+		active = append(active, targetHealthJSON{
+			Labels:              lbs,
+			ScrapePool:          lbs["job"],
+			ScrapeURL:           th.Target.URL,
+			LastError:           lastErr,
+			LastScrape:          th.LastScrape,
+			LastScrapeDuration:  th.LastScrapeDuration.Seconds(),
+			Health:              th.Health,
+			ConsecutiveFailures: th.ConsecutiveFailures,
+			RecentErrors:        errs,
+		})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"activeTargets":  active,
+			"droppedTargets": []interface{}{},
+		},
+	})
+}
+
+// ServeHTTP serves the health of all targets as JSON
+func (h *HealthRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b, err := h.MarshalJSON()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
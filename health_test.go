@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthRegistryRecord(t *testing.T) {
+	var h HealthRegistry
+	h.MaxErrorHistory = 2
+
+	tgt := &Target{URL: "http://localhost:9100/metrics"}
+	h.Register(tgt)
+
+	th, ok := h.Get(tgt)
+	if !ok {
+		t.Fatal("missing target")
+	}
+
+	if th.Health != HealthUnknown {
+		t.Fatal("incorrect health")
+	}
+
+	for i := 0; i < 3; i++ {
+		h.Record(&ScrapeResult{Target: tgt, Time: time.Now(), Err: fmt.Errorf("error %d", i)})
+	}
+
+	th, _ = h.Get(tgt)
+
+	if th.Health != HealthDown {
+		t.Fatal("incorrect health")
+	}
+
+	if th.ConsecutiveFailures != 3 {
+		t.Fatal("incorrect consecutive failures")
+	}
+
+	if th.LastError.Error() != "error 2" {
+		t.Fatal("incorrect last error")
+	}
+
+	if len(th.RecentErrors) != 2 || th.RecentErrors[0].Error != "error 1" {
+		t.Fatal("incorrect recent errors")
+	}
+
+	h.Record(&ScrapeResult{Target: tgt, Time: time.Now(), Duration: time.Second})
+	th, _ = h.Get(tgt)
+
+	if th.Health != HealthUp {
+		t.Fatal("incorrect health")
+	}
+
+	if th.ConsecutiveFailures != 0 || th.LastError != nil {
+		t.Fatal("expected failures to be reset")
+	}
+
+	if th.LastScrapeDuration != time.Second {
+		t.Fatal("incorrect last scrape duration")
+	}
+
+	if len(th.RecentErrors) != 2 {
+		t.Fatal("expected recent errors to be kept")
+	}
+
+	h.Remove(tgt)
+	if _, ok := h.Get(tgt); ok {
+		t.Fatal("expected target to be removed")
+	}
+}
+
+func TestHealthRegistryScraper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	var h HealthRegistry
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{Health: &h},
+		Targets: []*Target{
+			{URL: srv.URL + "/down", Labels: map[string]string{"job": "node"}},
+			{URL: srv.URL + "/metrics", Labels: map[string]string{"job": "node"}},
+		},
+	}
+	defer s.Close()
+
+	s.Scrape(context.Background())
+
+	ts := h.Targets()
+	if len(ts) != 2 {
+		t.Fatal("incorrect targets length")
+	}
+
+	if ts[0].Health != HealthDown || ts[1].Health != HealthUp {
+		t.Fatal("incorrect health")
+	}
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/api/v1/targets", nil))
+
+	var body struct {
+		Status string
+		Data   struct {
+			ActiveTargets []struct {
+				Labels     map[string]string
+				ScrapePool string
+				ScrapeURL  string
+				LastError  string
+				Health     string
+			}
+		}
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Status != "success" || len(body.Data.ActiveTargets) != 2 {
+		t.Fatal("incorrect JSON response")
+	}
+
+	at := body.Data.ActiveTargets[0]
+
+	if at.Health != "down" || at.LastError == "" {
+		t.Fatal("incorrect JSON health")
+	}
+
+	if at.ScrapePool != "node" || at.ScrapeURL != srv.URL+"/down" {
+		t.Fatal("incorrect JSON target")
+	}
+
+	if at.Labels["instance"] == "" {
+		t.Fatal("missing instance label")
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+const defaultHTTPSDRefreshInterval = time.Minute
+
+// HTTPSD discovers targets by polling a HTTP endpoint that returns target
+// groups in the Prometheus HTTP SD JSON format.
+type HTTPSD struct {
+	// URL is the endpoint that returns target groups
+	URL string
+	// RefreshInterval is how often the endpoint is polled. Defaults to 1m.
+	RefreshInterval time.Duration
+	// Client is used for requests, its URL is ignored. It provides TLS and
+	// authentication options. Defaults to a client with no options set.
+	Client *PromMetricsClient
+}
+
+// Refresh fetches the current target groups from the endpoint
+func (d *HTTPSD) Refresh(ctx context.Context) ([]*TargetGroup, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	c := d.Client
+	if c == nil {
+		c = defaultClient
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if ct, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); ct != "application/json" {
+		return nil, fmt.Errorf("unsupported content type %q", res.Header.Get("Content-Type"))
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	tgs := []*TargetGroup{}
+	if err := json.Unmarshal(b, &tgs); err != nil {
+		return nil, fmt.Errorf("invalid HTTP SD response: %w", err)
+	}
+
+	for i, tg := range tgs {
+		if tg == nil {
+			return nil, fmt.Errorf("invalid HTTP SD response: empty target group at index %d", i)
+		}
+		tg.Source = fmt.Sprintf("%s:%d", d.URL, i)
+	}
+	return tgs, nil
+}
+
+// Run implements Discoverer. If a poll fails the last good target groups are
+// kept.
+func (d *HTTPSD) Run(ctx context.Context, ch chan<- []*TargetGroup) {
+	interval := d.RefreshInterval
+	if interval <= 0 {
+		interval = defaultHTTPSDRefreshInterval
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var last []*TargetGroup
+	for {
+		tgs, err := d.Refresh(ctx)
+		if err == nil && (last == nil || !reflect.DeepEqual(tgs, last)) {
+			last = tgs
+			select {
+			case ch <- tgs:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
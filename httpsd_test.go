@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSD(t *testing.T) {
+	var fetches int32
+	tsrv := newTokenServer(3600, &fetches)
+	defer tsrv.Close()
+
+	var mu sync.Mutex
+	status := http.StatusOK
+	body := `[{"targets": ["web-1:8080"], "labels": {"job": "web"}}]`
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	set := func(s int, b string) {
+		mu.Lock()
+		defer mu.Unlock()
+		status, body = s, b
+	}
+
+	d := HTTPSD{
+		URL:             srv.URL,
+		RefreshInterval: 10 * time.Millisecond,
+		Client: &PromMetricsClient{
+			OAuth2: &OAuth2Config{ClientID: "client", ClientSecret: "s3cret", TokenURL: tsrv.URL},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan []*TargetGroup)
+	go d.Run(ctx, ch)
+
+	tgs := receiveGroups(t, ch)
+
+	if len(tgs) != 1 || tgs[0].Targets[0] != "web-1:8080" || tgs[0].Labels["job"] != "web" {
+		t.Fatal("incorrect target groups")
+	}
+
+	if tgs[0].Source != srv.URL+":0" {
+		t.Fatal("incorrect source")
+	}
+
+	set(http.StatusInternalServerError, `oops`)
+
+	select {
+	case <-ch:
+		t.Fatal("expected failed poll to keep last target groups")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	set(http.StatusOK, `[{"targets": ["web-1:8080", "web-2:8080"]}]`)
+
+	tgs = receiveGroups(t, ch)
+
+	if len(tgs) != 1 || len(tgs[0].Targets) != 2 {
+		t.Fatal("incorrect target groups")
+	}
+}
+
+func TestHTTPSDRefreshErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"targets": []}`))
+	}))
+	defer srv.Close()
+
+	d := HTTPSD{URL: srv.URL + "/text"}
+	if _, err := d.Refresh(context.Background()); err == nil {
+		t.Fatal("expected unsupported content type error")
+	}
+
+	d = HTTPSD{URL: srv.URL + "/object"}
+	if _, err := d.Refresh(context.Background()); err == nil {
+		t.Fatal("expected invalid response error")
+	}
+}
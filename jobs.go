@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobManager runs a ScrapeManager for every scrape config in a Config.
+// Applying a new config only restarts the jobs whose config has changed.
+type JobManager struct {
+	// SyntheticMetrics adds synthetic metrics to the results of every job, see
+	// ScrapeOptions.
+	SyntheticMetrics bool
+	// Health records the health of every scraped target. Optional.
+	Health *HealthRegistry
+
+	mu   sync.Mutex
+	jobs map[string]*job
+
+	subsMu sync.Mutex
+	subs   []func(*ScrapeResult)
+}
+
+type job struct {
+	cfg     *ScrapeConfig
+	manager *ScrapeManager
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// Subscribe registers fn to be called with the result of every scrape of
+// every job.
+func (jm *JobManager) Subscribe(fn func(*ScrapeResult)) {
+	jm.subsMu.Lock()
+	defer jm.subsMu.Unlock()
+	jm.subs = append(jm.subs, fn)
+}
+
+// ApplyConfig starts jobs that are new in the config, restarts jobs whose
+// config has changed and stops jobs that have been removed. Jobs whose config
+// is unchanged keep running. The context bounds the lifetime of started jobs.
+func (jm *JobManager) ApplyConfig(ctx context.Context, cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if jm.jobs == nil {
+		jm.jobs = map[string]*job{}
+	}
+
+	keep := map[string]*ScrapeConfig{}
+	for _, sc := range cfg.ScrapeConfigs {
+		keep[sc.JobName] = sc
+	}
+
+	for name, j := range jm.jobs {
+		if sc, ok := keep[name]; ok && sc.Equal(j.cfg) {
+			continue
+		}
+		j.stop()
+		delete(jm.jobs, name)
+	}
+
+	for name, sc := range keep {
+		if _, ok := jm.jobs[name]; ok {
+			continue
+		}
+		j, err := jm.start(ctx, sc)
+		if err != nil {
+			return fmt.Errorf("failed to start job %q: %w", name, err)
+		}
+		jm.jobs[name] = j
+	}
+	return nil
+}
+
+// Stop stops all jobs
+func (jm *JobManager) Stop() {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	for name, j := range jm.jobs {
+		j.stop()
+		delete(jm.jobs, name)
+	}
+}
+
+// Jobs returns the names of the running jobs
+func (jm *JobManager) Jobs() []string {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	names := make([]string, 0, len(jm.jobs))
+	for name := range jm.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Targets returns the targets currently being scraped by a job
+func (jm *JobManager) Targets(name string) []*Target {
+	jm.mu.Lock()
+	j, ok := jm.jobs[name]
+	jm.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return j.manager.Targets()
+}
+
+func (jm *JobManager) start(ctx context.Context, sc *ScrapeConfig) (*job, error) {
+	m := &ScrapeManager{
+		ScrapeOptions: ScrapeOptions{
+			Client:               sc.Client(),
+			Timeout:              time.Duration(sc.ScrapeTimeout),
+			SyntheticMetrics:     jm.SyntheticMetrics,
+			Health:               jm.Health,
+			HonorLabels:          sc.HonorLabels,
+			IgnoreTimestamps:     !sc.HonorTimestamps,
+			MetricRelabelConfigs: sc.MetricRelabelConfigs,
+		},
+		Interval:       time.Duration(sc.ScrapeInterval),
+		RelabelConfigs: sc.RelabelConfigs,
+	}
+	m.Subscribe(jm.publish)
+
+	ctx, cancel := context.WithCancel(ctx)
+	j := &job{cfg: sc, manager: m, cancel: cancel, done: make(chan struct{})}
+
+	if err := m.Start(ctx, nil); err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		defer close(j.done)
+		m.Discover(ctx, sc.Discoverer())
+	}()
+	return j, nil
+}
+
+func (j *job) stop() {
+	j.cancel()
+	<-j.done
+	j.manager.Stop()
+}
+
+func (jm *JobManager) publish(r *ScrapeResult) {
+	jm.subsMu.Lock()
+	subs := jm.subs
+	jm.subsMu.Unlock()
+
+	for _, fn := range subs {
+		fn(r)
+	}
+}
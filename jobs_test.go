@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	load := func(jobs ...string) *Config {
+		var b strings.Builder
+		b.WriteString("scrape_configs:\n")
+		for _, j := range jobs {
+			b.WriteString(j)
+		}
+		cfg, err := LoadConfig([]byte(b.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	node := fmt.Sprintf(`
+  - job_name: node
+    scrape_interval: 50ms
+    static_configs: [{targets: ['%s']}]
+`, addr)
+	gogc := fmt.Sprintf(`
+  - job_name: go
+    scrape_interval: 50ms
+    static_configs: [{targets: ['%s']}]
+    metric_relabel_configs:
+      - source_labels: [__name__]
+        regex: go_gc_.*
+        action: keep
+`, addr)
+
+	jm := JobManager{}
+	defer jm.Stop()
+
+	results := make(chan *ScrapeResult, 100)
+	jm.Subscribe(func(r *ScrapeResult) {
+		select {
+		case results <- r:
+		default:
+		}
+	})
+
+	receiveJob := func(job string) *ScrapeResult {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case r := <-results:
+				if r.Target.Labels["job"] == job {
+					return r
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for job", job)
+			}
+		}
+	}
+
+	if err := jm.ApplyConfig(context.Background(), load(node, gogc)); err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs := jm.Jobs(); len(jobs) != 2 || jobs[0] != "go" || jobs[1] != "node" {
+		t.Fatal("incorrect jobs", jobs)
+	}
+
+	r := receiveJob("node")
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+
+	if m := findMetric(t, r.Metrics, "go_goroutines"); m.Samples[0].Labels["job"] != "node" || m.Samples[0].Labels["instance"] != addr {
+		t.Fatal("incorrect target labels")
+	}
+
+	r = receiveJob("go")
+	for _, m := range r.Metrics {
+		if !strings.HasPrefix(m.Name, "go_gc_") {
+			t.Fatal("expected metric relabel configs to be applied")
+		}
+	}
+
+	jm.mu.Lock()
+	nodeJob := jm.jobs["node"]
+	jm.mu.Unlock()
+
+	// the go job is removed, the node job is unchanged
+	if err := jm.ApplyConfig(context.Background(), load(node)); err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs := jm.Jobs(); len(jobs) != 1 || jobs[0] != "node" {
+		t.Fatal("incorrect jobs", jobs)
+	}
+
+	jm.mu.Lock()
+	unchanged := jm.jobs["node"] == nodeJob
+	jm.mu.Unlock()
+	if !unchanged {
+		t.Fatal("expected unchanged job to keep running")
+	}
+
+	// the node job is changed
+	changed := strings.Replace(node, "50ms", "40ms", 1)
+	if err := jm.ApplyConfig(context.Background(), load(changed)); err != nil {
+		t.Fatal(err)
+	}
+
+	jm.mu.Lock()
+	restarted := jm.jobs["node"] != nodeJob
+	jm.mu.Unlock()
+	if !restarted {
+		t.Fatal("expected changed job to be restarted")
+	}
+
+	if ts := jm.Targets("node"); len(ts) > 1 {
+		t.Fatal("incorrect targets", ts)
+	}
+
+	err := jm.ApplyConfig(context.Background(), &Config{ScrapeConfigs: []*ScrapeConfig{{}}})
+	if err == nil {
+		t.Fatal("expected invalid config error")
+	}
+}
+
+func TestJobManagerRemovesHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	cfg, err := LoadConfig([]byte(fmt.Sprintf(`
+scrape_configs:
+  - job_name: node
+    scrape_interval: 50ms
+    static_configs: [{targets: ['%s']}]
+`, strings.TrimPrefix(srv.URL, "http://"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jm := JobManager{Health: &HealthRegistry{}}
+	defer jm.Stop()
+
+	scraped := make(chan struct{}, 1)
+	jm.Subscribe(func(r *ScrapeResult) {
+		select {
+		case scraped <- struct{}{}:
+		default:
+		}
+	})
+
+	if err := jm.ApplyConfig(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-scraped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for scrape")
+	}
+
+	if ths := jm.Health.Targets(); len(ths) != 1 || ths[0].Health != HealthUp {
+		t.Fatal("expected scraped target to be up", ths)
+	}
+
+	// the node job is removed
+	if err := jm.ApplyConfig(context.Background(), &Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ths := jm.Health.Targets(); len(ths) != 0 {
+		t.Fatal("expected removed job's targets to be removed from health", ths)
+	}
+}
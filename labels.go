@@ -0,0 +1,161 @@
+package client
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// Label is a label name and value
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Labels is a set of labels sorted by name. Create it with LabelsFromMap or
+// NewLabels so that it is sorted and has no duplicate names. A slice can't be
+// a map key, so use Key to track a series across scrapes.
+type Labels []Label
+
+// NewLabels creates labels from name and value pairs. If a name is given more
+// than once the last value is used.
+func NewLabels(ls ...Label) Labels {
+	m := make(map[string]string, len(ls))
+	for _, l := range ls {
+		m[l.Name] = l.Value
+	}
+	return LabelsFromMap(m)
+}
+
+// LabelsFromMap creates sorted labels from a map
+func LabelsFromMap(m map[string]string) Labels {
+	ls := make(Labels, 0, len(m))
+	for k, v := range m {
+		ls = append(ls, Label{Name: k, Value: v})
+	}
+	sort.Sort(ls)
+	return ls
+}
+
+func (ls Labels) Len() int           { return len(ls) }
+func (ls Labels) Less(i, j int) bool { return ls[i].Name < ls[j].Name }
+func (ls Labels) Swap(i, j int)      { ls[i], ls[j] = ls[j], ls[i] }
+
+// Map returns the labels as a map
+func (ls Labels) Map() map[string]string {
+	m := make(map[string]string, len(ls))
+	for _, l := range ls {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+// Get returns the value of a label, or an empty string if it is not set
+func (ls Labels) Get(name string) string {
+	i := sort.Search(len(ls), func(i int) bool { return ls[i].Name >= name })
+	if i < len(ls) && ls[i].Name == name {
+		return ls[i].Value
+	}
+	return ""
+}
+
+// Has reports whether the label is set
+func (ls Labels) Has(name string) bool {
+	i := sort.Search(len(ls), func(i int) bool { return ls[i].Name >= name })
+	return i < len(ls) && ls[i].Name == name
+}
+
+// Hash returns a stable 64-bit fingerprint of the labels
+func (ls Labels) Hash() uint64 {
+	h := fnv.New64a()
+	sep := []byte{0xff}
+	for _, l := range ls {
+		h.Write([]byte(l.Name))
+		h.Write(sep)
+		h.Write([]byte(l.Value))
+		h.Write(sep)
+	}
+	return h.Sum64()
+}
+
+// Key returns a comparable key for the labels, for use in maps. Equal label
+// sets have the same key and different label sets have different keys.
+func (ls Labels) Key() string {
+	return ls.String()
+}
+
+// String formats the labels as {a="b",c="d"}. Values are escaped as in the
+// text exposition format, so the string is unique to the label set.
+func (ls Labels) String() string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range ls {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteByte('"')
+		b.WriteString(labelValueEscaper.Replace(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Equal reports whether the labels are the same
+func (ls Labels) Equal(o Labels) bool {
+	if len(ls) != len(o) {
+		return false
+	}
+	for i := range ls {
+		if ls[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// With returns a copy of the labels with the label set
+func (ls Labels) With(name, value string) Labels {
+	i := sort.Search(len(ls), func(i int) bool { return ls[i].Name >= name })
+	if i < len(ls) && ls[i].Name == name {
+		out := append(Labels{}, ls...)
+		out[i].Value = value
+		return out
+	}
+	out := make(Labels, 0, len(ls)+1)
+	out = append(out, ls[:i]...)
+	out = append(out, Label{Name: name, Value: value})
+	return append(out, ls[i:]...)
+}
+
+// Without returns a copy of the labels without the named labels
+func (ls Labels) Without(names ...string) Labels {
+	return ls.filter(names, false)
+}
+
+// Keep returns a copy of the labels with only the named labels
+func (ls Labels) Keep(names ...string) Labels {
+	return ls.filter(names, true)
+}
+
+func (ls Labels) filter(names []string, keep bool) Labels {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	out := Labels{}
+	for _, l := range ls {
+		if set[l.Name] == keep {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Series returns the labels of the sample with its name as the __name__
+// label, identifying its series
+func (s *Sample) Series() Labels {
+	return LabelsFromMap(s.Labels).With(MetricNameLabel, s.Name)
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	ls := LabelsFromMap(map[string]string{"job": "node", "instance": "a:9100", "env": "prod"})
+
+	if ls.String() != `{env="prod",instance="a:9100",job="node"}` {
+		t.Fatal("incorrect string", ls.String())
+	}
+
+	if ls.Get("job") != "node" || ls.Get("missing") != "" || !ls.Has("env") || ls.Has("missing") {
+		t.Fatal("incorrect label lookup")
+	}
+
+	same := NewLabels(Label{"job", "other"}, Label{"env", "prod"}, Label{"instance", "a:9100"}, Label{"job", "node"})
+
+	if !ls.Equal(same) || ls.Hash() != same.Hash() || ls.String() != same.String() {
+		t.Fatal("expected labels to be equal")
+	}
+
+	with := ls.With("job", "web")
+	if with.Get("job") != "web" || ls.Get("job") != "node" {
+		t.Fatal("expected With to replace label in a copy")
+	}
+
+	if ls.Equal(with) || ls.Hash() == with.Hash() {
+		t.Fatal("expected labels not to be equal")
+	}
+
+	if s := ls.With("zone", "eu").With("a", "b").String(); s != `{a="b",env="prod",instance="a:9100",job="node",zone="eu"}` {
+		t.Fatal("expected With to keep labels sorted", s)
+	}
+
+	if s := ls.Without("instance", "missing").String(); s != `{env="prod",job="node"}` {
+		t.Fatal("incorrect Without", s)
+	}
+
+	if s := ls.Keep("instance", "missing").String(); s != `{instance="a:9100"}` {
+		t.Fatal("incorrect Keep", s)
+	}
+
+	// label names and values must not run together
+	a := NewLabels(Label{"a", "bc"})
+	b := NewLabels(Label{"ab", "c"})
+	if a.Hash() == b.Hash() || a.String() == b.String() {
+		t.Fatal("expected different hashes")
+	}
+
+	if (Labels{}).String() != "{}" || len(LabelsFromMap(nil)) != 0 {
+		t.Fatal("incorrect empty labels")
+	}
+}
+
+func TestLabelsStringEscaping(t *testing.T) {
+	ms, err := Parse(strings.NewReader(`m{a="x\"y",b="C:\\DIR",c="1\n2"} 1` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls := LabelsFromMap(ms[0].Samples[0].Labels)
+	if s := ls.String(); s != `{a="x\"y",b="C:\\DIR",c="1\n2"}` {
+		t.Fatal("expected values to be escaped as in the exposition format", s)
+	}
+}
+
+func TestSampleSeries(t *testing.T) {
+	ms := parseExample(t)
+	seen := map[string]bool{}
+	hashes := map[uint64]bool{}
+
+	for _, m := range ms {
+		for _, s := range m.Samples {
+			series := s.Series()
+			if series.Get(MetricNameLabel) != s.Name {
+				t.Fatal("expected series to include the sample name")
+			}
+			seen[series.Key()] = true
+			hashes[series.Hash()] = true
+		}
+	}
+
+	if len(seen) != 20 || len(hashes) != 20 {
+		t.Fatal("expected every series to be unique")
+	}
+
+	if m := LabelsFromMap(ms[0].Samples[0].Labels).Map(); m["code"] != "200" || len(m) != 2 {
+		t.Fatal("incorrect map")
+	}
+}
+
+func TestLabelsKey(t *testing.T) {
+	values := map[string]float64{}
+	for i := 0; i < 2; i++ {
+		for _, m := range parseExample(t) {
+			for _, s := range m.Samples {
+				values[s.Series().Key()] = s.Value + float64(i)
+			}
+		}
+	}
+
+	if len(values) != 20 {
+		t.Fatal("expected the series of both parses to share keys", len(values))
+	}
+
+	k := NewLabels(
+		Label{MetricNameLabel, "http_requests_total"},
+		Label{"method", "post"},
+		Label{"code", "200"},
+	).Key()
+	if v, ok := values[k]; !ok || v != 1028 {
+		t.Fatal("incorrect value for series", v)
+	}
+}
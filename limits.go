@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+)
+
+// ErrLimitExceeded is matched by a *LimitError, returned when a scrape exceeds one of its Limits
+var ErrLimitExceeded = fmt.Errorf("limit exceeded")
+
+// Names of the limits reported by a LimitError, matching the Prometheus scrape config options.
+const (
+	BodySizeLimit         = "body_size_limit"
+	SampleLimit           = "sample_limit"
+	LabelLimit            = "label_limit"
+	LabelNameLengthLimit  = "label_name_length_limit"
+	LabelValueLengthLimit = "label_value_length_limit"
+	LineLengthLimit       = "line_length_limit"
+)
+
+// Limits restricts the size of scraped data. A zero value means no limit.
+type Limits struct {
+	// MaxBodyBytes is the maximum size of the response body in bytes
+	MaxBodyBytes int64
+	// MaxSamples is the maximum number of samples
+	MaxSamples int
+	// MaxLabels is the maximum number of labels per sample
+	MaxLabels int
+	// MaxLabelNameLength is the maximum length of a label name
+	MaxLabelNameLength int
+	// MaxLabelValueLength is the maximum length of a label value
+	MaxLabelValueLength int
+	// MaxLineLength is the maximum length of a line
+	MaxLineLength int
+}
+
+// LimitError is returned when a scrape exceeds one of its Limits. It matches
+// ErrLimitExceeded when tested with errors.Is.
+type LimitError struct {
+	// Limit is the name of the limit that was exceeded e.g. SampleLimit
+	Limit string
+	// Max is the configured value of the limit
+	Max int64
+	// Line is the line at which the limit was exceeded, or -1 if not applicable
+	Line int
+}
+
+func (e *LimitError) Error() string {
+	if e.Line < 0 {
+		return fmt.Sprintf("%s of %d exceeded: %v", e.Limit, e.Max, ErrLimitExceeded)
+	}
+	return fmt.Sprintf("%s of %d exceeded at line %d: %v", e.Limit, e.Max, e.Line, ErrLimitExceeded)
+}
+
+// Is reports whether target is ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// checkSample checks the sample at line n, which is the count'th sample parsed
+func (l *Limits) checkSample(s *Sample, count int, n int) error {
+	if l.MaxSamples > 0 && count > l.MaxSamples {
+		return &LimitError{Limit: SampleLimit, Max: int64(l.MaxSamples), Line: n}
+	}
+	if l.MaxLabels > 0 && len(s.Labels) > l.MaxLabels {
+		return &LimitError{Limit: LabelLimit, Max: int64(l.MaxLabels), Line: n}
+	}
+	for k, v := range s.Labels {
+		if l.MaxLabelNameLength > 0 && len(k) > l.MaxLabelNameLength {
+			return &LimitError{Limit: LabelNameLengthLimit, Max: int64(l.MaxLabelNameLength), Line: n}
+		}
+		if l.MaxLabelValueLength > 0 && len(v) > l.MaxLabelValueLength {
+			return &LimitError{Limit: LabelValueLengthLimit, Max: int64(l.MaxLabelValueLength), Line: n}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func parseExampleWithLimits(t *testing.T, l *Limits) error {
+	content, err := ioutil.ReadFile("testdata/example.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseWithLimits(bytes.NewBuffer(content), l)
+	return err
+}
+
+func TestParseWithinLimits(t *testing.T) {
+	err := parseExampleWithLimits(t, &Limits{
+		MaxBodyBytes:        4096,
+		MaxSamples:          20,
+		MaxLabels:           2,
+		MaxLabelNameLength:  8,
+		MaxLabelValueLength: 32,
+		MaxLineLength:       128,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseLimitsExceeded(t *testing.T) {
+	tests := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{MaxBodyBytes: 100}, BodySizeLimit},
+		{Limits{MaxSamples: 19}, SampleLimit},
+		{Limits{MaxLabels: 1}, LabelLimit},
+		{Limits{MaxLabelNameLength: 4}, LabelNameLengthLimit},
+		{Limits{MaxLabelValueLength: 16}, LabelValueLengthLimit},
+		{Limits{MaxLineLength: 64}, LineLengthLimit},
+	}
+
+	for _, tt := range tests {
+		err := parseExampleWithLimits(t, &tt.limits)
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Fatal("expected limit exceeded error for", tt.limit)
+		}
+
+		var lerr *LimitError
+		if !errors.As(err, &lerr) {
+			t.Fatal("expected LimitError")
+		}
+
+		if lerr.Limit != tt.limit {
+			t.Fatal("incorrect limit", lerr.Limit, "expected", tt.limit)
+		}
+	}
+}
+
+// endlessReader repeats its data forever
+type endlessReader struct {
+	data []byte
+	n    int
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.data[r.n%len(r.data)]
+		r.n++
+	}
+	return len(p), nil
+}
+
+func TestParseLimitsStopReading(t *testing.T) {
+	tests := []struct {
+		r      io.Reader
+		limits Limits
+		limit  string
+	}{
+		{&endlessReader{data: []byte("up 1\n")}, Limits{MaxSamples: 10}, SampleLimit},
+		{&endlessReader{data: []byte("x")}, Limits{MaxLineLength: 64}, LineLengthLimit},
+		{&endlessReader{data: []byte("up 1\n")}, Limits{MaxBodyBytes: 1024}, BodySizeLimit},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseWithLimits(tt.r, &tt.limits)
+
+		var lerr *LimitError
+		if !errors.As(err, &lerr) || lerr.Limit != tt.limit {
+			t.Fatal("expected limit error for", tt.limit, err)
+		}
+	}
+}
+
+func TestGetBodySizeLimitExceeded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:    fmt.Sprintf("%s/metrics", srv.URL),
+		Limits: &Limits{MaxBodyBytes: 1024},
+	}
+
+	_, err := c.GetMetrics()
+
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Limit != BodySizeLimit {
+		t.Fatal("expected body size limit error")
+	}
+}
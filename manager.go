@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrManagerRunning is returned when starting a ScrapeManager that is already running
+var ErrManagerRunning = fmt.Errorf("scrape manager already running")
+
+const defaultScrapeInterval = time.Minute
+
+// ScrapeManager scrapes targets periodically. Each target is scraped at a
+// stable offset within the interval, derived from a hash of the target, so
+// that load is spread evenly. Scrapes of a target never overlap; if a scrape
+// takes longer than the interval the missed scrapes are skipped.
+type ScrapeManager struct {
+	ScrapeOptions
+	// Interval is the time between scrapes of each target. Defaults to 1m.
+	// The scrape timeout defaults to the interval.
+	Interval time.Duration
+	// JitterSeed is mixed into every target's offset so that managers scraping
+	// the same targets from different places don't scrape at the same time.
+	JitterSeed uint64
+	// RelabelConfigs are applied to targets found by Discover
+	RelabelConfigs []*RelabelConfig
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	loops   map[string]*scrapeLoop
+	running bool
+
+	subsMu sync.Mutex
+	subs   []func(*ScrapeResult)
+}
+
+type scrapeLoop struct {
+	target *Target
+	cancel context.CancelFunc
+	// mu is held while the loop is scraping
+	mu sync.Mutex
+}
+
+// stop cancels the loop and waits for an in-flight scrape to return. It does
+// not wait for subscribers, so it is safe to call from one.
+func (l *scrapeLoop) stop() {
+	l.cancel()
+	l.mu.Lock()
+	l.mu.Unlock()
+}
+
+// Subscribe registers fn to be called with the result of every scrape. fn is
+// called from the scrape loop of the target, so a slow subscriber delays the
+// next scrape of that target.
+func (m *ScrapeManager) Subscribe(fn func(*ScrapeResult)) {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+	m.subs = append(m.subs, fn)
+}
+
+// Start starts scraping the targets. The context bounds the lifetime of all
+// scrapes.
+func (m *ScrapeManager) Start(ctx context.Context, targets []*Target) error {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return ErrManagerRunning
+	}
+	m.running = true
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	m.loops = map[string]*scrapeLoop{}
+	m.mu.Unlock()
+
+	m.Reload(targets)
+	return nil
+}
+
+// Reload replaces the scraped targets. Loops for targets that are unchanged
+// keep running on their existing schedule, removed targets are stopped and new
+// targets are started.
+func (m *ScrapeManager) Reload(targets []*Target) {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+
+	keep := map[string]*Target{}
+	for _, t := range targets {
+		keep[targetKey(t)] = t
+	}
+
+	stopped := map[string]*scrapeLoop{}
+	for k, l := range m.loops {
+		if _, ok := keep[k]; !ok {
+			stopped[k] = l
+			delete(m.loops, k)
+		}
+	}
+
+	for k, t := range keep {
+		if _, ok := m.loops[k]; ok {
+			continue
+		}
+		if m.Health != nil {
+			m.Health.Register(t)
+		}
+		ctx, cancel := context.WithCancel(m.ctx)
+		l := &scrapeLoop{target: t, cancel: cancel}
+		m.loops[k] = l
+		go m.run(ctx, l)
+	}
+	m.mu.Unlock()
+
+	// wait for the stopped loops without holding m.mu, so that subscribers can
+	// call the manager in the meantime
+	for _, l := range stopped {
+		l.stop()
+	}
+
+	if m.Health == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, l := range stopped {
+		// a concurrent reload may have added the target back
+		if _, ok := m.loops[k]; !ok {
+			m.Health.Remove(l.target)
+		}
+	}
+}
+
+// Stop stops all scrape loops, cancelling in-flight scrapes and waiting for
+// them to return, and removes their targets from Health. Subscribers may
+// still be running when Stop returns, so it can be called from a subscriber.
+func (m *ScrapeManager) Stop() {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return
+	}
+
+	m.cancel()
+	stopped := m.loops
+	m.loops = nil
+	m.running = false
+	m.mu.Unlock()
+
+	for _, l := range stopped {
+		l.stop()
+	}
+
+	if m.Health == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, l := range stopped {
+		// the manager may have been started again with the target
+		if _, ok := m.loops[k]; !ok {
+			m.Health.Remove(l.target)
+		}
+	}
+}
+
+// Targets returns the targets currently being scraped
+func (m *ScrapeManager) Targets() []*Target {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ts []*Target
+	for _, l := range m.loops {
+		ts = append(ts, l.target)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return targetKey(ts[i]) < targetKey(ts[j])
+	})
+	return ts
+}
+
+func (m *ScrapeManager) interval() time.Duration {
+	if m.Interval <= 0 {
+		return defaultScrapeInterval
+	}
+	return m.Interval
+}
+
+func (m *ScrapeManager) run(ctx context.Context, l *scrapeLoop) {
+	interval := m.interval()
+	opts := m.ScrapeOptions
+	if opts.Timeout <= 0 {
+		opts.Timeout = interval
+	}
+
+	wait := time.NewTimer(targetOffset(l.target, interval, m.JitterSeed, time.Now()))
+	select {
+	case <-wait.C:
+	case <-ctx.Done():
+		wait.Stop()
+		return
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var st scrapeState
+	for {
+		l.mu.Lock()
+		if ctx.Err() != nil {
+			l.mu.Unlock()
+			return
+		}
+		r := opts.scrape(ctx, l.target, &st)
+		l.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		m.publish(r)
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *ScrapeManager) publish(r *ScrapeResult) {
+	m.subsMu.Lock()
+	subs := m.subs
+	m.subsMu.Unlock()
+
+	for _, fn := range subs {
+		fn(r)
+	}
+}
+
+// targetOffset returns how long to wait before the first scrape of the target,
+// such that it is always scraped at the same offset within the interval.
+func targetOffset(t *Target, interval time.Duration, seed uint64, now time.Time) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(targetKey(t)))
+
+	var (
+		base   = int64(interval) - now.UnixNano()%int64(interval)
+		offset = (h.Sum64() ^ seed) % uint64(interval)
+		next   = base + int64(offset)
+	)
+
+	if next > int64(interval) {
+		next -= int64(interval)
+	}
+	return time.Duration(next)
+}
+
+// targetKey identifies a target by its URL and labels
+func targetKey(t *Target) string {
+	return t.URL + LabelsFromMap(t.Labels).Key()
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type resultCollector struct {
+	mu sync.Mutex
+	rs []*ScrapeResult
+}
+
+func (c *resultCollector) collect(r *ScrapeResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rs = append(c.rs, r)
+}
+
+func (c *resultCollector) count(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for _, r := range c.rs {
+		if r.Target.URL == url {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTargetOffset(t *testing.T) {
+	tgt := &Target{URL: "http://localhost:9100/metrics"}
+	interval := 10 * time.Second
+	now := time.Unix(1600000000, 0)
+
+	off := targetOffset(tgt, interval, 0, now)
+	if off < 0 || off > interval {
+		t.Fatal("offset out of range", off)
+	}
+
+	// scraping at now+off must always land on the same point in the interval
+	slot := now.Add(off).UnixNano() % int64(interval)
+	for _, d := range []time.Duration{time.Second, 3 * time.Second, 7500 * time.Millisecond} {
+		later := now.Add(d)
+		if later.Add(targetOffset(tgt, interval, 0, later)).UnixNano()%int64(interval) != slot {
+			t.Fatal("offset is not stable")
+		}
+	}
+
+	other := &Target{URL: "http://localhost:9200/metrics"}
+	if targetOffset(other, interval, 0, now) == off {
+		t.Fatal("expected different targets to have different offsets")
+	}
+
+	if targetOffset(tgt, interval, 42, now) == off {
+		t.Fatal("expected jitter seed to change offset")
+	}
+}
+
+func TestScrapeManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	a := &Target{URL: srv.URL + "/a"}
+	b := &Target{URL: srv.URL + "/b"}
+	c := &Target{URL: srv.URL + "/c"}
+
+	var rc resultCollector
+	m := ScrapeManager{
+		// scrapes can take longer than the interval on a loaded machine
+		ScrapeOptions: ScrapeOptions{Timeout: time.Second},
+		Interval:      20 * time.Millisecond,
+	}
+	m.Subscribe(rc.collect)
+
+	if err := m.Start(context.Background(), []*Target{a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Start(context.Background(), nil); err != ErrManagerRunning {
+		t.Fatal("expected manager running error")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if rc.count(a.URL) < 3 || rc.count(b.URL) < 3 {
+		t.Fatal("expected targets to be scraped repeatedly")
+	}
+
+	m.Reload([]*Target{b, c})
+
+	na := rc.count(a.URL)
+	time.Sleep(150 * time.Millisecond)
+
+	if rc.count(a.URL) != na {
+		t.Fatal("expected removed target to stop being scraped")
+	}
+
+	if rc.count(c.URL) < 3 {
+		t.Fatal("expected new target to be scraped")
+	}
+
+	if len(m.Targets()) != 2 {
+		t.Fatal("incorrect targets length")
+	}
+
+	m.Stop()
+
+	nb := rc.count(b.URL)
+	time.Sleep(50 * time.Millisecond)
+
+	if rc.count(b.URL) != nb {
+		t.Fatal("expected scraping to stop")
+	}
+
+	for _, r := range rc.rs {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+}
+
+func TestScrapeManagerNoOverlap(t *testing.T) {
+	var inflight, overlaps, requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&inflight, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&inflight, -1)
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	m := ScrapeManager{Interval: 20 * time.Millisecond}
+
+	// a slow subscriber makes each scrape take longer than the interval
+	m.Subscribe(func(r *ScrapeResult) {
+		time.Sleep(50 * time.Millisecond)
+	})
+
+	if err := m.Start(context.Background(), []*Target{{URL: srv.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	m.Stop()
+
+	if atomic.LoadInt32(&overlaps) != 0 {
+		t.Fatal("scrapes overlapped")
+	}
+
+	if n := atomic.LoadInt32(&requests); n > 6 {
+		t.Fatal("expected missed scrapes to be skipped", n)
+	}
+}
+
+func TestScrapeManagerStopFromSubscriber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	m := ScrapeManager{Interval: 20 * time.Millisecond}
+
+	stopped := make(chan struct{})
+	var once sync.Once
+	m.Subscribe(func(r *ScrapeResult) {
+		m.Targets()
+		m.Reload([]*Target{{URL: srv.URL + "/b"}})
+		once.Do(func() {
+			m.Stop()
+			close(stopped)
+		})
+	})
+
+	if err := m.Start(context.Background(), []*Target{{URL: srv.URL + "/a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected subscriber to stop the manager")
+	}
+
+	if len(m.Targets()) != 0 {
+		t.Fatal("expected no targets after stop")
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"sort"
+)
+
+// MetricSet indexes parsed metrics for fast lookup of families by name, series
+// by label set and samples by label value. It must not be modified after it
+// has been created.
+type MetricSet struct {
+	metrics []*Metric
+	byName  map[string]*Metric
+	series  map[string]*Sample
+
+	// samples and families are parallel: samples[i] belongs to families[i]
+	samples  []*Sample
+	families []int
+	// postings are the sorted sample indices for each label name and value.
+	// The sample name is indexed as __name__.
+	postings map[string]map[string][]int
+}
+
+// NewMetricSet indexes the metrics. If a series appears more than once the
+// first sample is indexed for lookup by label set.
+func NewMetricSet(ms []*Metric) *MetricSet {
+	s := MetricSet{
+		metrics:  ms,
+		byName:   make(map[string]*Metric, len(ms)),
+		series:   map[string]*Sample{},
+		postings: map[string]map[string][]int{},
+	}
+
+	for fi, m := range ms {
+		if _, ok := s.byName[m.Name]; !ok {
+			s.byName[m.Name] = m
+		}
+		for _, smp := range m.Samples {
+			i := len(s.samples)
+			s.samples = append(s.samples, smp)
+			s.families = append(s.families, fi)
+
+			if k := seriesKey(smp); s.series[k] == nil {
+				s.series[k] = smp
+			}
+
+			s.addPosting(MetricNameLabel, smp.Name, i)
+			for k, v := range smp.Labels {
+				s.addPosting(k, v, i)
+			}
+		}
+	}
+	return &s
+}
+
+func (s *MetricSet) addPosting(name, value string, i int) {
+	vs, ok := s.postings[name]
+	if !ok {
+		vs = map[string][]int{}
+		s.postings[name] = vs
+	}
+	vs[value] = append(vs[value], i)
+}
+
+// Metrics returns the indexed metric families
+func (s *MetricSet) Metrics() []*Metric {
+	return s.metrics
+}
+
+// Len returns the number of samples in the set
+func (s *MetricSet) Len() int {
+	return len(s.samples)
+}
+
+// Metric returns the metric family with the name, or nil
+func (s *MetricSet) Metric(name string) *Metric {
+	return s.byName[name]
+}
+
+// Sample returns the sample with the name and exactly the labels, or nil
+func (s *MetricSet) Sample(name string, lbs map[string]string) *Sample {
+	return s.series[seriesKey(&Sample{Name: name, Labels: lbs})]
+}
+
+// Select returns the metric families with the samples that match a selector,
+// see Select.
+func (s *MetricSet) Select(selector string) ([]*Metric, error) {
+	matchers, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.SelectMatchers(matchers...), nil
+}
+
+// SelectMatchers returns the metric families with the samples that match all
+// of the matchers. Equality matchers are resolved with the postings index,
+// other matchers are then checked against the remaining samples.
+func (s *MetricSet) SelectMatchers(matchers ...*Matcher) []*Metric {
+	var ids []int
+	indexed := false
+
+	var rest []*Matcher
+	for _, m := range matchers {
+		// an empty value also matches samples without the label, which are
+		// not in the postings
+		if m.Type != MatchEqual || m.Value == "" {
+			rest = append(rest, m)
+			continue
+		}
+
+		p := s.postings[m.Name][m.Value]
+		if !indexed {
+			ids = p
+			indexed = true
+		} else {
+			ids = intersect(ids, p)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+	}
+
+	if !indexed {
+		ids = make([]int, len(s.samples))
+		for i := range ids {
+			ids[i] = i
+		}
+	}
+
+	var out []*Metric
+	last := -1
+	for _, i := range ids {
+		smp := s.samples[i]
+		if !matchesAll(rest, smp) {
+			continue
+		}
+		if fi := s.families[i]; fi != last {
+			m := s.metrics[fi]
+			out = append(out, &Metric{Name: m.Name, Description: m.Description, Type: m.Type})
+			last = fi
+		}
+		o := out[len(out)-1]
+		o.Samples = append(o.Samples, smp)
+	}
+	return out
+}
+
+// intersect returns the values in both sorted slices
+func intersect(a, b []int) []int {
+	var out []int
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			out = append(out, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return out
+}
+
+// Names returns the sorted names of the metric families
+func (s *MetricSet) Names() []string {
+	names := make([]string, 0, len(s.byName))
+	for n := range s.byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetricSet(t *testing.T) {
+	ms := parseExample(t)
+	s := NewMetricSet(ms)
+
+	if s.Len() != 20 {
+		t.Fatal("incorrect samples length")
+	}
+
+	if m := s.Metric("http_request_duration_seconds"); m == nil || m.Type != HistogramType {
+		t.Fatal("incorrect metric")
+	}
+
+	if s.Metric("http_request_duration_seconds_bucket") != nil {
+		t.Fatal("expected metric to be looked up by family name")
+	}
+
+	smp := s.Sample("http_requests_total", map[string]string{"code": "400", "method": "post"})
+	if smp == nil || smp.Value != 3 {
+		t.Fatal("incorrect sample")
+	}
+
+	if s.Sample("http_requests_total", map[string]string{"code": "400"}) != nil {
+		t.Fatal("expected sample lookup to match the exact label set")
+	}
+
+	smp = s.Sample("metric_without_timestamp_and_labels", nil)
+	if smp == nil || smp.Value != 12.47 {
+		t.Fatal("incorrect sample without labels")
+	}
+
+	smp = s.Sample("msdos_file_access_time_seconds", map[string]string{
+		"path":  `C:\DIR\FILE.TXT`,
+		"error": "Cannot find file:\n\"FILE.TXT\"",
+	})
+	if smp == nil {
+		t.Fatal("expected sample with unescaped labels")
+	}
+
+	sel, err := s.Select(`msdos_file_access_time_seconds{error="Cannot find file:\n\"FILE.TXT\""}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sel) != 1 || len(sel[0].Samples) != 1 || sel[0].Samples[0] != smp {
+		t.Fatal("expected Select to find the same sample as Sample")
+	}
+
+	if names := s.Names(); len(names) != 6 || names[0] != "http_request_duration_seconds" {
+		t.Fatal("incorrect names", names)
+	}
+}
+
+func TestMetricSetSelect(t *testing.T) {
+	ms := parseExample(t)
+	s := NewMetricSet(ms)
+
+	selectors := []string{
+		`http_requests_total`,
+		`http_requests_total{code="200"}`,
+		`http_requests_total{code="200", method="get"}`,
+		`http_requests_total{code!="200", method="post"}`,
+		`http_requests_total{method=""}`,
+		`metric_without_timestamp_and_labels{method=""}`,
+		`{__name__=~"http_.*"}`,
+		`http_request_duration_seconds_bucket{le=~"0\\..*"}`,
+		`rpc_duration_seconds`,
+		`{quantile="0.99"}`,
+		`{le="+Inf"}`,
+		`{path="C:\\DIR\\FILE.TXT"}`,
+		`missing`,
+	}
+
+	for _, sel := range selectors {
+		expected, err := Select(ms, sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := s.Select(sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatal("incorrect selection for", sel)
+		}
+	}
+
+	if _, err := s.Select(`{`); err == nil {
+		t.Fatal("expected selector parse error")
+	}
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta is how long before its actual expiry a token is considered
+// expired, so that requests in flight don't fail.
+const tokenExpiryDelta = 10 * time.Second
+
+// OAuth2Config configures OAuth2 client credentials authentication. Tokens are
+// obtained from the token endpoint and cached until they expire.
+type OAuth2Config struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	// ClientSecretFile is read for the client secret each time a token is
+	// requested. It takes precedence over ClientSecret.
+	ClientSecretFile string   `yaml:"client_secret_file,omitempty"`
+	TokenURL         string   `yaml:"token_url"`
+	Scopes           []string `yaml:"scopes,omitempty"`
+	// EndpointParams are additional parameters sent to the token endpoint.
+	EndpointParams map[string]string `yaml:"endpoint_params,omitempty"`
+	// TLSConfig configures TLS for the token endpoint. The TLS configuration of
+	// the scraped target is not used for the token endpoint. Optional.
+	TLSConfig *TLSConfig `yaml:"tls_config,omitempty"`
+}
+
+// ErrOAuth2Token is matched by an *OAuth2Error when tested with errors.Is
+var ErrOAuth2Token = fmt.Errorf("failed to fetch oauth2 token")
+
+// OAuth2Error is returned when a token cannot be obtained from the token
+// endpoint. The target is not scraped, so it is never retried.
+type OAuth2Error struct {
+	// StatusCode is the HTTP status code of the token endpoint, or 0 if it did
+	// not respond
+	StatusCode int
+	// Status is the HTTP status line of the token endpoint
+	Status string
+	// Body is the start of the response body, truncated to 1KiB
+	Body []byte
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *OAuth2Error) Error() string {
+	msg := ErrOAuth2Token.Error()
+	if e.Status != "" {
+		msg += ": " + e.Status
+		if body := strings.TrimSpace(string(e.Body)); body != "" {
+			msg += ": " + body
+		}
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *OAuth2Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrOAuth2Token
+func (e *OAuth2Error) Is(target error) bool {
+	return target == ErrOAuth2Token
+}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// oauth2RoundTripper is a http.RoundTripper that adds an OAuth2 bearer token
+// to requests, fetching a new one when the cached token expires.
+type oauth2RoundTripper struct {
+	cfg  *OAuth2Config
+	next http.RoundTripper
+	// tokenRT is the transport for the token endpoint
+	tokenRT http.RoundTripper
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newOAuth2RoundTripper(cfg *OAuth2Config, next http.RoundTripper) (*oauth2RoundTripper, error) {
+	var tokenRT http.RoundTripper = http.DefaultTransport
+	if cfg.TLSConfig != nil {
+		trt, err := newTLSRoundTripper(cfg.TLSConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oauth2 TLS config: %w", err)
+		}
+		tokenRT = trt
+	}
+	return &oauth2RoundTripper{cfg: cfg, next: next, tokenRT: tokenRT}, nil
+}
+
+func (t *oauth2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tok, err := t.getToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return t.next.RoundTrip(req)
+}
+
+// getToken returns the cached token or fetches a new one if it has expired.
+func (t *oauth2RoundTripper) getToken(req *http.Request) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && (t.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.expiry)) {
+		return t.token, nil
+	}
+
+	tok, err := t.fetchToken(req)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = tok.AccessToken
+	t.expiry = time.Time{}
+	if tok.ExpiresIn > 0 {
+		t.expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	return t.token, nil
+}
+
+func (t *oauth2RoundTripper) fetchToken(req *http.Request) (*oauth2Token, error) {
+	secret := t.cfg.ClientSecret
+	if t.cfg.ClientSecretFile != "" {
+		b, err := ioutil.ReadFile(t.cfg.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client secret file: %w", err)
+		}
+		secret = strings.TrimSpace(string(b))
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "client_credentials")
+	if len(t.cfg.Scopes) > 0 {
+		v.Set("scope", strings.Join(t.cfg.Scopes, " "))
+	}
+	for k, p := range t.cfg.EndpointParams {
+		v.Set(k, p)
+	}
+
+	treq, err := http.NewRequestWithContext(req.Context(), http.MethodPost, t.cfg.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	treq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	treq.SetBasicAuth(url.QueryEscape(t.cfg.ClientID), url.QueryEscape(secret))
+
+	res, err := t.tokenRT.RoundTrip(treq)
+	if err != nil {
+		return nil, &OAuth2Error{Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		return nil, &OAuth2Error{StatusCode: res.StatusCode, Status: res.Status, Body: b}
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, &OAuth2Error{Err: fmt.Errorf("failed to read token response: %w", err)}
+	}
+
+	var tok oauth2Token
+	if err := json.Unmarshal(b, &tok); err != nil {
+		return nil, &OAuth2Error{Err: fmt.Errorf("invalid token response: %w", err)}
+	}
+
+	if tok.AccessToken == "" {
+		return nil, &OAuth2Error{Err: fmt.Errorf("token response missing access_token")}
+	}
+
+	return &tok, nil
+}
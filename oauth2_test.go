@@ -0,0 +1,222 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTokenServer(expiresIn int, fetches *int32) *httptest.Server {
+	return httptest.NewServer(tokenHandler(expiresIn, fetches))
+}
+
+func tokenHandler(expiresIn int, fetches *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, secret, ok := req.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(fetches, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d,"scope":"%s","audience":"%s"}`, n, expiresIn, req.FormValue("scope"), req.FormValue("audience"))
+	})
+}
+
+func newBearerServer(auth *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*auth = req.Header.Get("Authorization")
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+}
+
+func TestOAuth2CachesToken(t *testing.T) {
+	var fetches int32
+	tsrv := newTokenServer(3600, &fetches)
+	defer tsrv.Close()
+
+	var auth string
+	srv := newBearerServer(&auth)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		OAuth2: &OAuth2Config{
+			ClientID:       "client",
+			ClientSecret:   "s3cret",
+			TokenURL:       tsrv.URL,
+			Scopes:         []string{"metrics:read", "metrics:list"},
+			EndpointParams: map[string]string{"audience": "exporters"},
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		ms, err := c.GetMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+			t.Fatal("incorrect gauge value")
+		}
+	}
+
+	if auth != "Bearer token-1" {
+		t.Fatal("incorrect authorization header", auth)
+	}
+
+	if fetches != 1 {
+		t.Fatal("expected token to be cached")
+	}
+}
+
+func TestOAuth2RefreshesExpiredToken(t *testing.T) {
+	var fetches int32
+	tsrv := newTokenServer(1, &fetches)
+	defer tsrv.Close()
+
+	var auth string
+	srv := newBearerServer(&auth)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		OAuth2: &OAuth2Config{
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			TokenURL:     tsrv.URL,
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetMetrics(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if auth != "Bearer token-2" {
+		t.Fatal("incorrect authorization header", auth)
+	}
+
+	if fetches != 2 {
+		t.Fatal("expected expired token to be refreshed")
+	}
+}
+
+func TestOAuth2InvalidCredentials(t *testing.T) {
+	var fetches int32
+	tsrv := newTokenServer(3600, &fetches)
+	defer tsrv.Close()
+
+	var auth string
+	srv := newBearerServer(&auth)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		OAuth2: &OAuth2Config{
+			ClientID:     "client",
+			ClientSecret: "wrong",
+			TokenURL:     tsrv.URL,
+		},
+	}
+
+	if _, err := c.GetMetrics(); err == nil {
+		t.Fatal("expected token fetch error")
+	}
+
+	if auth != "" {
+		t.Fatal("expected target not to be scraped")
+	}
+}
+
+func TestOAuth2TokenErrorNotRetried(t *testing.T) {
+	var requests int32
+	tsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer tsrv.Close()
+
+	var auth string
+	srv := newBearerServer(&auth)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		OAuth2: &OAuth2Config{
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			TokenURL:     tsrv.URL,
+		},
+		Retry: &RetryPolicy{BaseBackoff: time.Millisecond},
+	}
+
+	_, err := c.GetMetrics()
+	if !errors.Is(err, ErrOAuth2Token) {
+		t.Fatal("expected oauth2 token error", err)
+	}
+
+	if errors.Is(err, ErrUnexpectedHTTPStatusCode) {
+		t.Fatal("expected token error not to be a target HTTP error")
+	}
+
+	var oerr *OAuth2Error
+	if !errors.As(err, &oerr) || oerr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("incorrect oauth2 error", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatal("expected token fetch not to be retried", n)
+	}
+}
+
+func TestOAuth2TokenTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-oauth2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newMemstatsTLSServer(t, dir)
+	defer srv.Close()
+
+	// the token endpoint doesn't support the TLS version required for the
+	// target, so it must not be reached with the target's TLS config
+	var fetches int32
+	tsrv := httptest.NewUnstartedServer(tokenHandler(3600, &fetches))
+	tsrv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	tsrv.StartTLS()
+	defer tsrv.Close()
+
+	ca := filepath.Join(dir, "ca.pem")
+	c := PromMetricsClient{
+		URL:       srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{CAFile: ca, MinVersion: tls.VersionTLS13},
+		OAuth2: &OAuth2Config{
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			TokenURL:     tsrv.URL,
+			TLSConfig:    &TLSConfig{CAFile: ca},
+		},
+	}
+
+	if _, err := c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches != 1 {
+		t.Fatal("expected token to be fetched")
+	}
+}
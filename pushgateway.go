@@ -0,0 +1,290 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pusher pushes metrics to a Prometheus Pushgateway.
+type Pusher struct {
+	// URL is the base URL of the Pushgateway e.g. http://localhost:9091
+	URL string
+	// Job is the job label of the pushed group
+	Job string
+	// Grouping holds additional labels that identify the pushed group
+	Grouping map[string]string
+	// Client is used for requests, its URL is ignored. It provides TLS and
+	// authentication options. Defaults to a client with no options set.
+	Client *PromMetricsClient
+}
+
+// PushGroup is a group of metrics held by a Pushgateway.
+type PushGroup struct {
+	// Labels are the grouping labels of the group, including job
+	Labels             map[string]string
+	LastPushSuccessful bool
+	Metrics            []*Metric
+}
+
+func (p *Pusher) client() *PromMetricsClient {
+	if p.Client == nil {
+		return defaultClient
+	}
+	return p.Client
+}
+
+// Push replaces all metrics in the group with the given metrics (HTTP PUT)
+func (p *Pusher) Push(ctx context.Context, ms []*Metric) error {
+	return p.send(ctx, http.MethodPut, ms)
+}
+
+// PushAdd replaces metrics in the group that have the same name as the given
+// metrics, leaving others untouched (HTTP POST)
+func (p *Pusher) PushAdd(ctx context.Context, ms []*Metric) error {
+	return p.send(ctx, http.MethodPost, ms)
+}
+
+// Delete deletes all metrics in the group (HTTP DELETE)
+func (p *Pusher) Delete(ctx context.Context) error {
+	return p.send(ctx, http.MethodDelete, nil)
+}
+
+// groupingPath returns the /metrics/job/<job>/<label>/<value> path for the
+// group. Grouping labels are ordered by name.
+func (p *Pusher) groupingPath() (string, error) {
+	if p.Job == "" {
+		return "", fmt.Errorf("job must not be empty")
+	}
+
+	var b strings.Builder
+	b.WriteString("/metrics")
+	b.WriteString(encodeGroupingLabel("job", p.Job))
+
+	names := make([]string, 0, len(p.Grouping))
+	for k := range p.Grouping {
+		if k == "job" {
+			return "", fmt.Errorf("grouping must not contain job label")
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		b.WriteString(encodeGroupingLabel(k, p.Grouping[k]))
+	}
+	return b.String(), nil
+}
+
+// encodeGroupingLabel encodes a label as a path segment pair, using base64
+// encoding for values that contain a slash or are empty.
+func encodeGroupingLabel(name, value string) string {
+	if value == "" {
+		return "/" + name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return "/" + name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + name + "/" + url.PathEscape(value)
+}
+
+func (p *Pusher) send(ctx context.Context, method string, ms []*Metric) error {
+	path, err := p.groupingPath()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if ms != nil {
+		var buf bytes.Buffer
+		if err := Encode(&buf, ms); err != nil {
+			return err
+		}
+		body = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	}
+
+	res, err := p.client().do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+type pushgatewayMetricsJSON struct {
+	Status string                       `json:"status"`
+	Data   []map[string]json.RawMessage `json:"data"`
+}
+
+type pushgatewayFamilyJSON struct {
+	Type    string `json:"type"`
+	Help    string `json:"help"`
+	Metrics []struct {
+		Labels    map[string]string `json:"labels"`
+		Value     string            `json:"value"`
+		Buckets   map[string]string `json:"buckets"`
+		Quantiles map[string]string `json:"quantiles"`
+		Count     string            `json:"count"`
+		Sum       string            `json:"sum"`
+	} `json:"metrics"`
+}
+
+// Groups reads all groups of metrics held by the Pushgateway from its
+// /api/v1/metrics API.
+func (p *Pusher) Groups(ctx context.Context) ([]*PushGroup, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.URL, "/")+"/api/v1/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.client().do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var body pushgatewayMetricsJSON
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, fmt.Errorf("invalid pushgateway metrics response: %w", err)
+	}
+
+	var gs []*PushGroup
+	for _, d := range body.Data {
+		g, err := parsePushGroup(d)
+		if err != nil {
+			return nil, err
+		}
+		gs = append(gs, g)
+	}
+	return gs, nil
+}
+
+func parsePushGroup(d map[string]json.RawMessage) (*PushGroup, error) {
+	g := PushGroup{Labels: map[string]string{}}
+
+	names := make([]string, 0, len(d))
+	for k := range d {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		v := d[k]
+		switch k {
+		case "labels":
+			if err := json.Unmarshal(v, &g.Labels); err != nil {
+				return nil, fmt.Errorf("invalid group labels: %w", err)
+			}
+		case "last_push_successful":
+			if err := json.Unmarshal(v, &g.LastPushSuccessful); err != nil {
+				return nil, fmt.Errorf("invalid last_push_successful: %w", err)
+			}
+		default:
+			var f pushgatewayFamilyJSON
+			if err := json.Unmarshal(v, &f); err != nil {
+				return nil, fmt.Errorf("invalid metric family %s: %w", k, err)
+			}
+			m, err := f.toMetric(k)
+			if err != nil {
+				return nil, err
+			}
+			g.Metrics = append(g.Metrics, m)
+		}
+	}
+
+	return &g, nil
+}
+
+func (f *pushgatewayFamilyJSON) toMetric(name string) (*Metric, error) {
+	m := Metric{Name: name, Description: f.Help}
+	if t := strings.ToLower(f.Type); t != "untyped" {
+		m.Type = MetricType(t)
+	}
+
+	add := func(name string, lbs map[string]string, v string) error {
+		val, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		m.Samples = append(m.Samples, &Sample{Name: name, Labels: lbs, Value: val})
+		return nil
+	}
+
+	with := func(lbs map[string]string, k, v string) map[string]string {
+		c := copyLabels(lbs)
+		c[k] = v
+		return c
+	}
+
+	for _, fm := range f.Metrics {
+		if fm.Labels == nil {
+			fm.Labels = map[string]string{}
+		}
+
+		var err error
+		switch m.Type {
+		case HistogramType:
+			for _, le := range sortedFloatKeys(fm.Buckets) {
+				if err = add(name+"_bucket", with(fm.Labels, "le", le), fm.Buckets[le]); err != nil {
+					return nil, err
+				}
+			}
+		case SummaryType:
+			for _, q := range sortedFloatKeys(fm.Quantiles) {
+				if err = add(name, with(fm.Labels, "quantile", q), fm.Quantiles[q]); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if err = add(name, fm.Labels, fm.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err = add(name+"_sum", copyLabels(fm.Labels), fm.Sum); err != nil {
+			return nil, err
+		}
+		if err = add(name+"_count", copyLabels(fm.Labels), fm.Count); err != nil {
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+// sortedFloatKeys returns the keys of the map ordered by their float value
+func sortedFloatKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(keys[i], 64)
+		b, _ := strconv.ParseFloat(keys[j], 64)
+		return a < b
+	})
+	return keys
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type pushRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+func newPushgatewayServer(reqs *[]pushRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/v1/metrics" {
+			http.ServeFile(w, req, "testdata/pushgateway.json")
+			return
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		*reqs = append(*reqs, pushRequest{req.Method, req.URL.EscapedPath(), b})
+		if req.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestGroupingPath(t *testing.T) {
+	tests := []struct {
+		job      string
+		grouping map[string]string
+		path     string
+	}{
+		{"backup", nil, "/metrics/job/backup"},
+		{"backup", map[string]string{"instance": "db1", "dc": "eu"}, "/metrics/job/backup/dc/eu/instance/db1"},
+		{"backup", map[string]string{"path": "/var/tmp"}, "/metrics/job/backup/path@base64/L3Zhci90bXA"},
+		{"a/b", map[string]string{"empty": ""}, "/metrics/job@base64/YS9i/empty@base64/="},
+		{"backup", map[string]string{"instance": "db 1"}, "/metrics/job/backup/instance/db%201"},
+	}
+
+	for _, tt := range tests {
+		p := Pusher{Job: tt.job, Grouping: tt.grouping}
+		path, err := p.groupingPath()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != tt.path {
+			t.Fatal("incorrect grouping path", path)
+		}
+	}
+
+	p := Pusher{Grouping: map[string]string{"instance": "db1"}}
+	if _, err := p.groupingPath(); err == nil {
+		t.Fatal("expected missing job error")
+	}
+}
+
+func TestPusher(t *testing.T) {
+	var reqs []pushRequest
+	srv := newPushgatewayServer(&reqs)
+	defer srv.Close()
+
+	ms := []*Metric{{
+		Name: "backup_rows_total",
+		Type: CounterType,
+		Samples: []*Sample{
+			{Name: "backup_rows_total", Labels: map[string]string{"table": "users"}, Value: 1027},
+		},
+	}}
+
+	p := Pusher{
+		URL:      srv.URL,
+		Job:      "backup",
+		Grouping: map[string]string{"instance": "db/primary"},
+	}
+
+	ctx := context.Background()
+
+	if err := p.Push(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.PushAdd(ctx, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reqs) != 3 {
+		t.Fatal("incorrect requests length")
+	}
+
+	methods := []string{http.MethodPut, http.MethodPost, http.MethodDelete}
+	for i, r := range reqs {
+		if r.method != methods[i] {
+			t.Fatal("incorrect method", r.method)
+		}
+		if r.path != "/metrics/job/backup/instance@base64/ZGIvcHJpbWFyeQ" {
+			t.Fatal("incorrect path", r.path)
+		}
+	}
+
+	pms, err := Parse(bytes.NewReader(reqs[0].body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, pms, "backup_rows_total"); m.Samples[0].Value != 1027 || m.Type != CounterType {
+		t.Fatal("incorrect pushed metric")
+	}
+
+	if len(reqs[2].body) != 0 {
+		t.Fatal("expected empty delete body")
+	}
+}
+
+func TestPusherEscapesLabelValues(t *testing.T) {
+	var reqs []pushRequest
+	srv := newPushgatewayServer(&reqs)
+	defer srv.Close()
+
+	value := "say \"hi\"\n\\o/"
+	ms := []*Metric{{
+		Name: "greetings_total",
+		Type: CounterType,
+		Samples: []*Sample{
+			{Name: "greetings_total", Labels: map[string]string{"greeting": value}, Value: 1},
+		},
+	}}
+
+	p := Pusher{URL: srv.URL, Job: "greeter"}
+	if err := p.Push(context.Background(), ms); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(reqs[0].body, []byte(`greetings_total{greeting="say \"hi\"\n\\o/"} 1`)) {
+		t.Fatal("expected label value to be escaped", string(reqs[0].body))
+	}
+
+	pms, err := Parse(bytes.NewReader(reqs[0].body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, pms, "greetings_total"); m.Samples[0].Labels["greeting"] != value {
+		t.Fatal("incorrect pushed label value", m.Samples[0].Labels["greeting"])
+	}
+}
+
+func TestPusherError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "pushed metrics are invalid or inconsistent with existing metrics", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	p := Pusher{URL: srv.URL, Job: "backup"}
+
+	err := p.Push(context.Background(), nil)
+
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != 400 {
+		t.Fatal("expected bad request HTTPError")
+	}
+}
+
+func TestPusherGroups(t *testing.T) {
+	var reqs []pushRequest
+	srv := newPushgatewayServer(&reqs)
+	defer srv.Close()
+
+	p := Pusher{URL: srv.URL}
+
+	gs, err := p.Groups(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gs) != 1 {
+		t.Fatal("incorrect groups length")
+	}
+
+	g := gs[0]
+
+	if g.Labels["job"] != "backup" || g.Labels["instance"] != "db/primary" {
+		t.Fatal("incorrect group labels")
+	}
+
+	if !g.LastPushSuccessful {
+		t.Fatal("incorrect last push successful")
+	}
+
+	if len(g.Metrics) != 3 {
+		t.Fatal("incorrect metrics length")
+	}
+
+	m := findMetric(t, g.Metrics, "backup_rows_total")
+
+	if m.Type != CounterType || m.Description != "Rows backed up." {
+		t.Fatal("incorrect metric")
+	}
+
+	if m.Samples[0].Labels["table"] != "users" || m.Samples[0].Value != 1027 {
+		t.Fatal("incorrect sample")
+	}
+
+	h, err := UpgradeHistogram(findMetric(t, g.Metrics, "backup_duration_seconds"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(h.Buckets) != 3 || h.Buckets[0].LE != 1 || h.Buckets[2].LE != math.Inf(1) || h.Buckets[2].Value != 3 {
+		t.Fatal("incorrect buckets")
+	}
+
+	if h.Sum != 42.5 || h.Count != 3 {
+		t.Fatal("incorrect sum or count")
+	}
+}
@@ -0,0 +1,416 @@
+package client
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RelabelAction is the action performed by a relabel config
+type RelabelAction string
+
+// Relabel actions, as in the Prometheus relabel_config
+const (
+	// RelabelReplace sets the target label to the replacement, expanded with
+	// the regex match of the source label values. If the regex does not match
+	// nothing is changed. An empty result removes the target label.
+	RelabelReplace RelabelAction = "replace"
+	// RelabelKeep drops the label set if the regex does not match the source
+	// label values
+	RelabelKeep RelabelAction = "keep"
+	// RelabelDrop drops the label set if the regex matches the source label
+	// values
+	RelabelDrop RelabelAction = "drop"
+	// RelabelKeepEqual drops the label set if the source label values are not
+	// equal to the value of the target label
+	RelabelKeepEqual RelabelAction = "keepequal"
+	// RelabelDropEqual drops the label set if the source label values are
+	// equal to the value of the target label
+	RelabelDropEqual RelabelAction = "dropequal"
+	// RelabelHashMod sets the target label to the modulus of a hash of the
+	// source label values
+	RelabelHashMod RelabelAction = "hashmod"
+	// RelabelLabelMap copies every label whose name matches the regex to the
+	// name given by the replacement
+	RelabelLabelMap RelabelAction = "labelmap"
+	// RelabelLabelDrop removes every label whose name matches the regex
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	// RelabelLabelKeep removes every label whose name does not match the regex
+	RelabelLabelKeep RelabelAction = "labelkeep"
+	// RelabelLowercase sets the target label to the lowercased source label
+	// values
+	RelabelLowercase RelabelAction = "lowercase"
+	// RelabelUppercase sets the target label to the uppercased source label
+	// values
+	RelabelUppercase RelabelAction = "uppercase"
+)
+
+// MetricNameLabel is the label that holds the sample name when relabeling
+// metrics
+const MetricNameLabel = "__name__"
+
+// Relabel config defaults
+const (
+	DefaultRelabelSeparator   = ";"
+	DefaultRelabelRegex       = "(.*)"
+	DefaultRelabelReplacement = "$1"
+)
+
+var (
+	defaultRelabelRegex = MustNewRegexp(DefaultRelabelRegex)
+	labelNameRegex      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Regexp is a regular expression that is anchored at both ends, as regexes in
+// Prometheus relabel configs are. The zero value is not a valid regex.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp compiles an anchored regex
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return Regexp{}, err
+	}
+	return Regexp{Regexp: re, original: s}, nil
+}
+
+// MustNewRegexp is like NewRegexp but panics if the regex does not compile
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// String returns the regex as it was given, without the anchors
+func (re Regexp) String() string {
+	return re.original
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	if re.Regexp == nil {
+		return nil, nil
+	}
+	return re.original, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (re *Regexp) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (re Regexp) MarshalJSON() ([]byte, error) {
+	if re.Regexp == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(re.original)
+}
+
+// RelabelConfig is a rule that rewrites a label set, as in the Prometheus
+// relabel_config. Configs read from YAML or JSON start from
+// DefaultRelabelConfig, so an explicitly empty separator or replacement is
+// kept. Configs created in Go should do the same, as the separator and
+// replacement are used as they are. A nil regex and an empty action are
+// replaced by their defaults.
+type RelabelConfig struct {
+	// SourceLabels are the labels whose values are joined with the separator
+	// and matched against the regex. Missing labels have an empty value.
+	SourceLabels []string `json:"source_labels,omitempty" yaml:"source_labels,flow,omitempty"`
+	// Separator joins the source label values. Defaults to ";".
+	Separator string `json:"separator" yaml:"separator"`
+	// Regex is matched against the joined source label values, or label
+	// names for the labelmap, labeldrop and labelkeep actions. Defaults to
+	// "(.*)".
+	Regex Regexp `json:"regex,omitempty" yaml:"regex,omitempty"`
+	// Modulus is used by the hashmod action
+	Modulus uint64 `json:"modulus,omitempty" yaml:"modulus,omitempty"`
+	// TargetLabel is the label written by the replace, hashmod, lowercase and
+	// uppercase actions, and compared by the keepequal and dropequal actions.
+	// For the replace action it may refer to regex capture groups.
+	TargetLabel string `json:"target_label,omitempty" yaml:"target_label,omitempty"`
+	// Replacement is expanded with the regex capture groups by the replace
+	// and labelmap actions. Defaults to "$1".
+	Replacement string `json:"replacement" yaml:"replacement"`
+	// Action is the action to perform. Defaults to replace.
+	Action RelabelAction `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+// DefaultRelabelConfig has the Prometheus relabel_config defaults
+var DefaultRelabelConfig = RelabelConfig{
+	Separator:   DefaultRelabelSeparator,
+	Regex:       defaultRelabelRegex,
+	Replacement: DefaultRelabelReplacement,
+	Action:      RelabelReplace,
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, setting the defaults for fields
+// that are not given
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	return unmarshal((*plain)(c))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, setting the defaults for fields
+// that are not given
+func (c *RelabelConfig) UnmarshalJSON(b []byte) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	return json.Unmarshal(b, (*plain)(c))
+}
+
+func (c *RelabelConfig) regex() Regexp {
+	if c.Regex.Regexp == nil {
+		return defaultRelabelRegex
+	}
+	return c.Regex
+}
+
+func (c *RelabelConfig) action() RelabelAction {
+	if c.Action == "" {
+		return RelabelReplace
+	}
+	return RelabelAction(strings.ToLower(string(c.Action)))
+}
+
+// hasRegex reports whether a regex other than the default is set
+func (c *RelabelConfig) hasRegex() bool {
+	return c.Regex.Regexp != nil && c.Regex.String() != DefaultRelabelRegex
+}
+
+// hasReplacement reports whether a replacement other than the default is set
+func (c *RelabelConfig) hasReplacement() bool {
+	return c.Replacement != "" && c.Replacement != DefaultRelabelReplacement
+}
+
+// Validate checks the config is complete for its action
+func (c *RelabelConfig) Validate() error {
+	a := c.action()
+	switch a {
+	case RelabelReplace, RelabelKeep, RelabelDrop, RelabelKeepEqual, RelabelDropEqual, RelabelHashMod,
+		RelabelLabelMap, RelabelLabelDrop, RelabelLabelKeep, RelabelLowercase, RelabelUppercase:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+
+	switch a {
+	case RelabelReplace, RelabelHashMod, RelabelLowercase, RelabelUppercase, RelabelKeepEqual, RelabelDropEqual:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel configuration for %s action requires 'target_label' value", a)
+		}
+	}
+
+	switch a {
+	case RelabelReplace:
+		if !strings.Contains(c.TargetLabel, "$") && !labelNameRegex.MatchString(c.TargetLabel) {
+			return fmt.Errorf("%q is invalid 'target_label' for %s action", c.TargetLabel, a)
+		}
+	case RelabelHashMod, RelabelLowercase, RelabelUppercase, RelabelKeepEqual, RelabelDropEqual:
+		if !labelNameRegex.MatchString(c.TargetLabel) {
+			return fmt.Errorf("%q is invalid 'target_label' for %s action", c.TargetLabel, a)
+		}
+	}
+
+	switch a {
+	case RelabelHashMod:
+		if c.Modulus == 0 {
+			return fmt.Errorf("relabel configuration for hashmod action requires 'modulus' value")
+		}
+	case RelabelKeepEqual, RelabelDropEqual:
+		if c.hasRegex() || c.Modulus != 0 || c.hasReplacement() {
+			return fmt.Errorf("%s action requires only 'source_labels' and 'target_label', and no other fields", a)
+		}
+	case RelabelLabelDrop, RelabelLabelKeep:
+		if len(c.SourceLabels) > 0 || c.TargetLabel != "" || c.Modulus != 0 || c.hasReplacement() {
+			return fmt.Errorf("%s action requires only 'regex', and no other fields", a)
+		}
+	}
+	return nil
+}
+
+// Relabel applies the relabel configs in order to a copy of the label set. It
+// returns false if the label set was dropped. Configs are expected to be
+// valid, invalid configs are skipped.
+func Relabel(lbs map[string]string, cfgs []*RelabelConfig) (map[string]string, bool) {
+	lbs = copyLabels(lbs)
+	for _, c := range cfgs {
+		if !relabel(lbs, c) {
+			return nil, false
+		}
+	}
+	return lbs, true
+}
+
+// RelabelMetrics applies the relabel configs to every sample, with the sample
+// name as the __name__ label. Samples that are dropped or left without a name
+// are removed, as are metric families left without samples. Renamed samples
+// are moved to the family named after their new name, which keeps the type
+// and description of the old family if the name keeps its suffix e.g. _bucket.
+// The metrics passed in are not modified.
+func RelabelMetrics(ms []*Metric, cfgs []*RelabelConfig) []*Metric {
+	if len(cfgs) == 0 {
+		return ms
+	}
+
+	var out []*Metric
+	byName := map[string]*Metric{}
+
+	family := func(name string, from *Metric) *Metric {
+		m, ok := byName[name]
+		if !ok {
+			m = &Metric{Name: name}
+			byName[name] = m
+			out = append(out, m)
+		}
+		if from != nil && m.Type == Untyped && m.Description == "" {
+			m.Description = from.Description
+			m.Type = from.Type
+		}
+		return m
+	}
+
+	for _, m := range ms {
+		for _, s := range m.Samples {
+			lbs := copyLabels(s.Labels)
+			lbs[MetricNameLabel] = s.Name
+
+			lbs, ok := Relabel(lbs, cfgs)
+			if !ok {
+				continue
+			}
+
+			name := lbs[MetricNameLabel]
+			if name == "" {
+				continue
+			}
+			delete(lbs, MetricNameLabel)
+
+			var f *Metric
+			switch suffix := strings.TrimPrefix(s.Name, m.Name); {
+			case name == s.Name:
+				f = family(m.Name, m)
+			case strings.HasPrefix(s.Name, m.Name) && strings.HasSuffix(name, suffix) && len(name) > len(suffix):
+				f = family(strings.TrimSuffix(name, suffix), m)
+			default:
+				f = family(name, nil)
+			}
+			f.Samples = append(f.Samples, &Sample{Name: name, Labels: lbs, Value: s.Value, Timestamp: s.Timestamp})
+		}
+	}
+	return out
+}
+
+// relabel applies a single relabel config to the label set in place
+func relabel(lbs map[string]string, c *RelabelConfig) bool {
+	vals := make([]string, len(c.SourceLabels))
+	for i, name := range c.SourceLabels {
+		vals[i] = lbs[name]
+	}
+	val := strings.Join(vals, c.Separator)
+	re := c.regex()
+
+	switch c.action() {
+	case RelabelDrop:
+		if re.MatchString(val) {
+			return false
+		}
+	case RelabelKeep:
+		if !re.MatchString(val) {
+			return false
+		}
+	case RelabelDropEqual:
+		if lbs[c.TargetLabel] == val {
+			return false
+		}
+	case RelabelKeepEqual:
+		if lbs[c.TargetLabel] != val {
+			return false
+		}
+	case RelabelReplace:
+		idx := re.FindStringSubmatchIndex(val)
+		if idx == nil {
+			break
+		}
+		target := string(re.ExpandString(nil, c.TargetLabel, val, idx))
+		if !labelNameRegex.MatchString(target) {
+			break
+		}
+		setLabel(lbs, target, string(re.ExpandString(nil, c.Replacement, val, idx)))
+	case RelabelLowercase:
+		setLabel(lbs, c.TargetLabel, strings.ToLower(val))
+	case RelabelUppercase:
+		setLabel(lbs, c.TargetLabel, strings.ToUpper(val))
+	case RelabelHashMod:
+		if c.Modulus == 0 {
+			break
+		}
+		sum := md5.Sum([]byte(val))
+		mod := binary.BigEndian.Uint64(sum[md5.Size-8:]) % c.Modulus
+		setLabel(lbs, c.TargetLabel, strconv.FormatUint(mod, 10))
+	case RelabelLabelMap:
+		mapped := map[string]string{}
+		for k, v := range lbs {
+			if re.MatchString(k) {
+				mapped[re.ReplaceAllString(k, c.Replacement)] = v
+			}
+		}
+		for k, v := range mapped {
+			setLabel(lbs, k, v)
+		}
+	case RelabelLabelDrop:
+		for k := range lbs {
+			if re.MatchString(k) {
+				delete(lbs, k)
+			}
+		}
+	case RelabelLabelKeep:
+		for k := range lbs {
+			if !re.MatchString(k) {
+				delete(lbs, k)
+			}
+		}
+	}
+	return true
+}
+
+// setLabel sets a label, removing it if the value is empty
+func setLabel(lbs map[string]string, name, value string) {
+	if value == "" {
+		delete(lbs, name)
+		return
+	}
+	lbs[name] = value
+}
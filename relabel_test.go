@@ -0,0 +1,416 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRelabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  map[string]string
+		cfgs   []*RelabelConfig
+		output map[string]string
+	}{
+		{
+			name:  "replace",
+			input: map[string]string{"a": "foo", "b": "bar"},
+			cfgs: []*RelabelConfig{{
+				SourceLabels: []string{"a", "b"},
+				Separator:    ";",
+				Regex:        MustNewRegexp("f(.*);(.*)"),
+				TargetLabel:  "c",
+				Replacement:  "${1}-$2",
+			}},
+			output: map[string]string{"a": "foo", "b": "bar", "c": "oo-bar"},
+		},
+		{
+			name:  "replace is anchored",
+			input: map[string]string{"a": "foo"},
+			cfgs: []*RelabelConfig{{
+				SourceLabels: []string{"a"},
+				Regex:        MustNewRegexp("o+"),
+				TargetLabel:  "b",
+			}},
+			output: map[string]string{"a": "foo"},
+		},
+		{
+			name:   "replace with default regex",
+			input:  map[string]string{"a": "foo"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"a"}, TargetLabel: "b", Replacement: "$1"}},
+			output: map[string]string{"a": "foo", "b": "foo"},
+		},
+		{
+			name:  "replace target label from capture group",
+			input: map[string]string{"a": "some-name-value"},
+			cfgs: []*RelabelConfig{{
+				SourceLabels: []string{"a"},
+				Regex:        MustNewRegexp("some-([^-]+)-([^,]+)"),
+				TargetLabel:  "${1}",
+				Replacement:  "${2}",
+			}},
+			output: map[string]string{"a": "some-name-value", "name": "value"},
+		},
+		{
+			name:   "replace with empty value removes label",
+			input:  map[string]string{"a": "foo"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"b"}, TargetLabel: "a"}},
+			output: map[string]string{},
+		},
+		{
+			name:   "keep",
+			input:  map[string]string{"a": "foo"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"a"}, Regex: MustNewRegexp("f.*"), Action: RelabelKeep}},
+			output: map[string]string{"a": "foo"},
+		},
+		{
+			name:  "keep drops",
+			input: map[string]string{"a": "foo"},
+			cfgs:  []*RelabelConfig{{SourceLabels: []string{"a"}, Regex: MustNewRegexp("f"), Action: RelabelKeep}},
+		},
+		{
+			name:  "drop",
+			input: map[string]string{"a": "foo"},
+			cfgs:  []*RelabelConfig{{SourceLabels: []string{"a"}, Regex: MustNewRegexp("f.*"), Action: RelabelDrop}},
+		},
+		{
+			name:   "keepequal",
+			input:  map[string]string{"a": "foo", "b": "foo"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"a"}, TargetLabel: "b", Action: RelabelKeepEqual}},
+			output: map[string]string{"a": "foo", "b": "foo"},
+		},
+		{
+			name:  "dropequal",
+			input: map[string]string{"a": "foo", "b": "foo"},
+			cfgs:  []*RelabelConfig{{SourceLabels: []string{"a"}, TargetLabel: "b", Action: RelabelDropEqual}},
+		},
+		{
+			name:   "hashmod",
+			input:  map[string]string{"a": "foo", "b": "bar", "c": "baz"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"c"}, TargetLabel: "d", Modulus: 1000, Action: RelabelHashMod}},
+			output: map[string]string{"a": "foo", "b": "bar", "c": "baz", "d": "976"},
+		},
+		{
+			name:   "labelmap",
+			input:  map[string]string{"__meta_dns_name": "web", "a": "foo"},
+			cfgs:   []*RelabelConfig{{Regex: MustNewRegexp("__meta_(.+)"), Replacement: "$1", Action: RelabelLabelMap}},
+			output: map[string]string{"__meta_dns_name": "web", "dns_name": "web", "a": "foo"},
+		},
+		{
+			name:   "labeldrop",
+			input:  map[string]string{"a": "foo", "ab": "bar", "b": "baz"},
+			cfgs:   []*RelabelConfig{{Regex: MustNewRegexp("a.*"), Action: RelabelLabelDrop}},
+			output: map[string]string{"b": "baz"},
+		},
+		{
+			name:   "labelkeep",
+			input:  map[string]string{"a": "foo", "ab": "bar", "b": "baz"},
+			cfgs:   []*RelabelConfig{{Regex: MustNewRegexp("a.*"), Action: RelabelLabelKeep}},
+			output: map[string]string{"a": "foo", "ab": "bar"},
+		},
+		{
+			name:   "lowercase",
+			input:  map[string]string{"a": "FoO"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"a"}, TargetLabel: "b", Action: RelabelLowercase}},
+			output: map[string]string{"a": "FoO", "b": "foo"},
+		},
+		{
+			name:   "uppercase",
+			input:  map[string]string{"a": "FoO"},
+			cfgs:   []*RelabelConfig{{SourceLabels: []string{"a"}, TargetLabel: "a", Action: RelabelUppercase}},
+			output: map[string]string{"a": "FOO"},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, c := range tt.cfgs {
+			if err := c.Validate(); err != nil {
+				t.Fatal(tt.name, err)
+			}
+		}
+
+		in := copyLabels(tt.input)
+		lbs, ok := Relabel(tt.input, tt.cfgs)
+
+		if tt.output == nil {
+			if ok {
+				t.Fatal("expected label set to be dropped for", tt.name)
+			}
+			continue
+		}
+
+		if !ok {
+			t.Fatal("expected label set to be kept for", tt.name)
+		}
+
+		if !reflect.DeepEqual(lbs, tt.output) {
+			t.Fatal("incorrect labels for", tt.name, lbs)
+		}
+
+		if !reflect.DeepEqual(tt.input, in) {
+			t.Fatal("expected input labels not to be modified for", tt.name)
+		}
+	}
+}
+
+func TestRelabelConfigValidate(t *testing.T) {
+	tests := []*RelabelConfig{
+		{Action: "nope"},
+		{SourceLabels: []string{"a"}},
+		{SourceLabels: []string{"a"}, TargetLabel: "1abc"},
+		{SourceLabels: []string{"a"}, TargetLabel: "b", Action: RelabelHashMod},
+		{SourceLabels: []string{"a"}, TargetLabel: "b", Regex: MustNewRegexp("a"), Action: RelabelKeepEqual},
+		{SourceLabels: []string{"a"}, Regex: MustNewRegexp("a"), Action: RelabelLabelDrop},
+	}
+
+	for _, c := range tests {
+		if err := c.Validate(); err == nil {
+			t.Fatal("expected validation error for", c)
+		}
+	}
+}
+
+func TestRelabelConfigYAML(t *testing.T) {
+	in := `
+- source_labels: [__meta_dns_name]
+  regex: '_metrics\._tcp\.(.+)\.service\.consul'
+  target_label: job
+- regex: __meta_dns_(.+)
+  action: labelmap
+`
+	var cfgs []*RelabelConfig
+	if err := yaml.UnmarshalStrict([]byte(in), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfgs) != 2 || cfgs[0].Regex.String() != `_metrics\._tcp\.(.+)\.service\.consul` || cfgs[1].Action != RelabelLabelMap {
+		t.Fatal("incorrect relabel configs")
+	}
+
+	out, err := yaml.Marshal(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(out), `regex: _metrics\._tcp\.(.+)\.service\.consul`) {
+		t.Fatal("incorrect marshalled regex", string(out))
+	}
+
+	if err := yaml.Unmarshal([]byte(`- regex: '('`), &cfgs); err == nil {
+		t.Fatal("expected invalid regex error")
+	}
+}
+
+func TestRelabelConfigEmptyValues(t *testing.T) {
+	in := `
+- source_labels: [a, b]
+  separator: ""
+  target_label: c
+- source_labels: [a]
+  target_label: d
+  replacement: ""
+- source_labels: [a, b]
+  target_label: e
+`
+	var cfgs []*RelabelConfig
+	if err := yaml.UnmarshalStrict([]byte(in), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"a": "foo", "b": "bar", "c": "foobar", "e": "foo;bar"}
+
+	lbs, _ := Relabel(map[string]string{"a": "foo", "b": "bar", "d": "baz"}, cfgs)
+	if !reflect.DeepEqual(lbs, expected) {
+		t.Fatal("incorrect labels", lbs)
+	}
+
+	var jcfgs []*RelabelConfig
+	jin := `[{"source_labels":["a","b"],"separator":"","target_label":"c"},{"source_labels":["a"],"target_label":"d","replacement":""},{"source_labels":["a","b"],"target_label":"e"}]`
+	if err := json.Unmarshal([]byte(jin), &jcfgs); err != nil {
+		t.Fatal(err)
+	}
+
+	lbs, _ = Relabel(map[string]string{"a": "foo", "b": "bar", "d": "baz"}, jcfgs)
+	if !reflect.DeepEqual(lbs, expected) {
+		t.Fatal("incorrect labels from JSON config", lbs)
+	}
+}
+
+func TestTargetsFromGroupsRelabel(t *testing.T) {
+	tgs := []*TargetGroup{{
+		Targets: []string{"web-1.node.consul:8080", "db-1.node.consul:9187"},
+		Labels:  map[string]string{DNSNameLabel: "_metrics._tcp.web.service.consul"},
+	}}
+
+	ts := TargetsFromGroups(tgs,
+		&RelabelConfig{SourceLabels: []string{AddressLabel}, Regex: MustNewRegexp("web-.*"), Action: RelabelKeep},
+		&RelabelConfig{SourceLabels: []string{DNSNameLabel}, Regex: MustNewRegexp(`_metrics\._tcp\.(.+)\.service\.consul`), TargetLabel: "job", Replacement: "$1"},
+		&RelabelConfig{SourceLabels: []string{MetricsPathLabel}, TargetLabel: MetricsPathLabel, Replacement: "/probe$1"},
+		&RelabelConfig{SourceLabels: []string{AddressLabel}, Regex: MustNewRegexp("([^.]+).*"), TargetLabel: "instance", Replacement: "$1"},
+	)
+
+	if len(ts) != 1 {
+		t.Fatal("incorrect targets length")
+	}
+
+	if ts[0].URL != "http://web-1.node.consul:8080/probe/metrics" {
+		t.Fatal("incorrect target URL", ts[0].URL)
+	}
+
+	if !reflect.DeepEqual(ts[0].Labels, map[string]string{"job": "web", "instance": "web-1"}) {
+		t.Fatal("incorrect target labels", ts[0].Labels)
+	}
+}
+
+func TestRelabelMetrics(t *testing.T) {
+	f, err := os.Open("testdata/example.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ms, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := RelabelMetrics(ms, []*RelabelConfig{
+		{SourceLabels: []string{MetricNameLabel}, Regex: MustNewRegexp("rpc_duration_seconds.*"), Action: RelabelDrop},
+		{SourceLabels: []string{MetricNameLabel}, Regex: MustNewRegexp("http_request_duration_seconds_(bucket|sum)"), Action: RelabelDrop},
+		{SourceLabels: []string{MetricNameLabel, "code"}, Separator: ";", Regex: MustNewRegexp("http_requests_total;4.."), Action: RelabelDrop},
+		{SourceLabels: []string{MetricNameLabel}, Regex: MustNewRegexp("metric_without_(.*)"), TargetLabel: MetricNameLabel, Replacement: "renamed_$1"},
+		{SourceLabels: []string{MetricNameLabel}, Regex: MustNewRegexp("http_request_duration_seconds_(.*)"), TargetLabel: MetricNameLabel, Replacement: "api_duration_seconds_$1"},
+	})
+
+	for _, m := range out {
+		if m.Name == "rpc_duration_seconds" {
+			t.Fatal("expected family without samples to be dropped")
+		}
+	}
+
+	m := findMetric(t, out, "api_duration_seconds")
+	if len(m.Samples) != 1 || m.Samples[0].Name != "api_duration_seconds_count" || m.Type != HistogramType {
+		t.Fatal("expected only renamed _count sample to be kept")
+	}
+
+	m = findMetric(t, out, "http_requests_total")
+	if len(m.Samples) != 1 || m.Samples[0].Labels["code"] != "200" || m.Samples[0].Timestamp != 1395066363000 {
+		t.Fatal("incorrect http_requests_total samples")
+	}
+
+	if _, ok := m.Samples[0].Labels[MetricNameLabel]; ok {
+		t.Fatal("expected __name__ label to be removed")
+	}
+
+	m = findMetric(t, out, "renamed_timestamp_and_labels")
+	if len(m.Samples) != 1 || m.Samples[0].Name != "renamed_timestamp_and_labels" || m.Samples[0].Value != 12.47 {
+		t.Fatal("incorrect renamed sample", m.Samples[0].Name)
+	}
+
+	for _, m := range out {
+		if m.Name == "metric_without_timestamp_and_labels" || m.Name == "http_request_duration_seconds" {
+			t.Fatal("expected renamed samples to leave their family", m.Name)
+		}
+	}
+
+	if len(findMetric(t, ms, "rpc_duration_seconds").Samples) != 7 {
+		t.Fatal("expected input metrics not to be modified")
+	}
+}
+
+func TestScrapeMetricRelabel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/example.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{
+			SyntheticMetrics: true,
+			MetricRelabelConfigs: []*RelabelConfig{
+				// target labels are visible to metric relabeling
+				{SourceLabels: []string{"job", MetricNameLabel}, Separator: ";", Regex: MustNewRegexp("example;http_.*"), Action: RelabelKeep},
+			},
+		},
+		Targets: []*Target{{URL: srv.URL, Labels: map[string]string{"job": "example"}}},
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+	if rs[0].Err != nil {
+		t.Fatal(rs[0].Err)
+	}
+
+	names := map[string]bool{}
+	for _, m := range rs[0].Metrics {
+		names[m.Name] = true
+	}
+
+	if !names["http_requests_total"] || !names["http_request_duration_seconds"] || names["rpc_duration_seconds"] {
+		t.Fatal("incorrect relabeled metrics", names)
+	}
+
+	if !names["up"] {
+		t.Fatal("expected synthetic metrics not to be relabeled")
+	}
+
+	if m := findMetric(t, rs[0].Metrics, "scrape_samples_scraped"); m.Samples[0].Value != 20 {
+		t.Fatal("incorrect samples scraped")
+	}
+
+	if m := findMetric(t, rs[0].Metrics, "scrape_series_added"); m.Samples[0].Value != 10 {
+		t.Fatal("incorrect series added")
+	}
+}
+
+func TestScrapeMetricRelabelSampleLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/example.txt")
+	}))
+	defer srv.Close()
+
+	cfgs := []*RelabelConfig{
+		{SourceLabels: []string{MetricNameLabel}, Regex: MustNewRegexp("http_.*"), Action: RelabelKeep},
+	}
+
+	// the example has 20 samples, 10 of which are kept
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{
+			Client:               &PromMetricsClient{Limits: &Limits{MaxSamples: 10}},
+			MetricRelabelConfigs: cfgs,
+		},
+		Targets: []*Target{{URL: srv.URL}},
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+	if rs[0].Err != nil {
+		t.Fatal(rs[0].Err)
+	}
+
+	if countSamples(rs[0].Metrics) != 10 {
+		t.Fatal("incorrect samples length")
+	}
+
+	s.Client.Limits.MaxSamples = 9
+
+	rs = s.Scrape(context.Background())
+
+	var lerr *LimitError
+	if !errors.As(rs[0].Err, &lerr) || lerr.Limit != SampleLimit {
+		t.Fatal("expected sample limit error", rs[0].Err)
+	}
+
+	if rs[0].Metrics != nil {
+		t.Fatal("expected no metrics when the sample limit is exceeded")
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 5 * time.Second
+)
+
+// DefaultRetryableStatusCodes are the HTTP status codes retried when a
+// RetryPolicy does not specify any.
+var DefaultRetryableStatusCodes = []int{502, 503, 504}
+
+// RetryPolicy configures retrying of failed requests with exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Defaults to 3.
+	MaxAttempts int
+	// BaseBackoff is the wait before the first retry, doubled for each
+	// subsequent retry. Defaults to 100ms.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. Defaults to 5s.
+	MaxBackoff time.Duration
+	// Jitter is the fraction (0-1) of each backoff that is randomized.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP status codes that are retried.
+	// Defaults to DefaultRetryableStatusCodes.
+	RetryableStatusCodes []int
+	// IsRetryable decides if an error other than an *HTTPError is retried.
+	// Defaults to retrying connection errors and timeouts. Failures to fetch
+	// an OAuth2 token are never retried.
+	IsRetryable func(error) bool
+}
+
+// RetryError is returned when a request with a RetryPolicy fails. It records
+// the error from every attempt and unwraps to the last one.
+type RetryError struct {
+	// Attempts holds the error from each attempt, in order
+	Attempts []error
+}
+
+func (e *RetryError) Error() string {
+	msgs := make([]string, len(e.Attempts))
+	for i, err := range e.Attempts {
+		msgs[i] = fmt.Sprintf("attempt %d: %v", i+1, err)
+	}
+	return fmt.Sprintf("failed after %d attempt(s): %s", len(e.Attempts), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the error from the last attempt
+func (e *RetryError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrOAuth2Token) {
+		return false
+	}
+
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		codes := p.RetryableStatusCodes
+		if codes == nil {
+			codes = DefaultRetryableStatusCodes
+		}
+		for _, c := range codes {
+			if herr.StatusCode == c {
+				return true
+			}
+		}
+		return false
+	}
+
+	if p.IsRetryable != nil {
+		return p.IsRetryable(err)
+	}
+	return isRetryableError(err)
+}
+
+// isRetryableError reports whether err is a connection error or timeout
+func isRetryableError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	var operr *net.OpError
+	return errors.As(err, &operr)
+}
+
+// backoff returns the wait before the given retry (starting at 1)
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	base := p.BaseBackoff
+	if base <= 0 {
+		base = defaultRetryBaseBackoff
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+
+	d := base
+	for i := 1; i < retry && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// do calls fn until it succeeds, returns a non-retryable error or the
+// attempts are exhausted. It stops early rather than wait past the context
+// deadline.
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) error {
+	max := p.MaxAttempts
+	if max <= 0 {
+		max = defaultRetryMaxAttempts
+	}
+
+	var errs []error
+	for n := 1; ; n++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+
+		if n >= max || !p.retryable(err) {
+			return &RetryError{Attempts: errs}
+		}
+
+		d := p.backoff(n)
+		if dl, ok := ctx.Deadline(); ok && time.Now().Add(d).After(dl) {
+			return &RetryError{Attempts: errs}
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return &RetryError{Attempts: errs}
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer responds with the given status codes in turn, then serves
+// memstats.txt.
+func newFlakyServer(codes []int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := int(atomic.AddInt32(requests, 1))
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+			return
+		}
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	var requests int32
+	srv := newFlakyServer([]int{502, 503}, &requests)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:   srv.URL + "/metrics",
+		Retry: &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond},
+	}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+
+	if requests != 3 {
+		t.Fatal("incorrect number of attempts")
+	}
+}
+
+func TestRetryRecordsAttempts(t *testing.T) {
+	var requests int32
+	srv := newFlakyServer([]int{503, 503, 503, 503}, &requests)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:   srv.URL + "/metrics",
+		Retry: &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, Jitter: 0.5},
+	}
+
+	_, err := c.GetMetrics()
+
+	var rerr *RetryError
+	if !errors.As(err, &rerr) {
+		t.Fatal("expected RetryError")
+	}
+
+	if len(rerr.Attempts) != 3 {
+		t.Fatal("incorrect number of recorded attempts")
+	}
+
+	if !errors.Is(err, ErrUnexpectedHTTPStatusCode) {
+		t.Fatal("expected last attempt to be unexpected HTTP status code")
+	}
+
+	if requests != 3 {
+		t.Fatal("incorrect number of attempts")
+	}
+}
+
+func TestRetryNonRetryableStatusCode(t *testing.T) {
+	var requests int32
+	srv := newFlakyServer([]int{401}, &requests)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:   srv.URL + "/metrics",
+		Retry: &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond},
+	}
+
+	if _, err := c.GetMetrics(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if requests != 1 {
+		t.Fatal("expected no retries")
+	}
+}
+
+func TestRetryCustomStatusCodes(t *testing.T) {
+	var requests int32
+	srv := newFlakyServer([]int{429}, &requests)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		Retry: &RetryPolicy{
+			MaxAttempts:          2,
+			BaseBackoff:          time.Millisecond,
+			RetryableStatusCodes: []int{429},
+		},
+	}
+
+	if _, err := c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 2 {
+		t.Fatal("incorrect number of attempts")
+	}
+}
+
+func TestRetryConnectionError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL + "/metrics"
+	srv.Close()
+
+	c := PromMetricsClient{
+		URL:   url,
+		Retry: &RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond},
+	}
+
+	_, err := c.GetMetrics()
+
+	var rerr *RetryError
+	if !errors.As(err, &rerr) {
+		t.Fatal("expected RetryError")
+	}
+
+	if len(rerr.Attempts) != 2 {
+		t.Fatal("expected connection error to be retried")
+	}
+}
+
+func TestRetryRespectsContextDeadline(t *testing.T) {
+	var requests int32
+	srv := newFlakyServer([]int{503, 503, 503}, &requests)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:   srv.URL + "/metrics",
+		Retry: &RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Second},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.GetMetricsContext(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("waited past context deadline")
+	}
+
+	if requests != 1 {
+		t.Fatal("incorrect number of attempts")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	if p.backoff(1) != 100*time.Millisecond {
+		t.Fatal("incorrect backoff")
+	}
+
+	if p.backoff(3) != 400*time.Millisecond {
+		t.Fatal("incorrect backoff")
+	}
+
+	if p.backoff(10) != time.Second {
+		t.Fatal("expected backoff to be capped")
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(2); d < 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Fatal("jittered backoff out of range")
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrScraperClosed is returned for targets that were not scraped because the scraper was closed
+var ErrScraperClosed = fmt.Errorf("scraper closed")
+
+const defaultScrapeConcurrency = 10
+
+// Target is an endpoint to scrape.
+type Target struct {
+	URL string
+	// Labels identify the target e.g. job and instance. They are attached to
+	// every sample scraped from the target. The instance label defaults to the
+	// host and port of the URL.
+	Labels map[string]string
+}
+
+// ScrapeResult is the outcome of scraping a target.
+type ScrapeResult struct {
+	Target  *Target
+	Metrics []*Metric
+	Err     error
+	// Time is when the scrape started
+	Time time.Time
+	// Duration is how long the scrape took
+	Duration time.Duration
+	// Bytes is the size of the uncompressed response body
+	Bytes int64
+}
+
+// ScrapeOptions configure how targets are scraped.
+type ScrapeOptions struct {
+	// Client is used to scrape targets, its URL is ignored. Defaults to a
+	// client with no options set.
+	Client *PromMetricsClient
+	// Timeout is the timeout for each scrape. Zero means no timeout.
+	Timeout time.Duration
+	// SyntheticMetrics adds the metrics Prometheus generates for every scrape
+	// to the results: up, scrape_duration_seconds, scrape_samples_scraped,
+	// scrape_series_added and scrape_response_size_bytes. They are labelled
+	// with the job and instance of the target, and are reported even if the
+	// scrape fails.
+	SyntheticMetrics bool
+	// Health records the health of every scraped target. Optional.
+	Health *HealthRegistry
+	// HonorLabels keeps the value of scraped labels that conflict with target
+	// labels. Otherwise conflicting scraped labels are renamed to
+	// exported_<name>, as Prometheus does when honor_labels is false.
+	HonorLabels bool
+	// IgnoreTimestamps replaces the timestamps of scraped samples with the
+	// scrape time in milliseconds, as Prometheus does when honor_timestamps is
+	// false.
+	IgnoreTimestamps bool
+	// MetricRelabelConfigs are applied to every scraped sample, after the
+	// target labels have been attached. The sample limit of the client is
+	// checked after relabeling. Synthetic metrics are not relabeled.
+	MetricRelabelConfigs []*RelabelConfig
+}
+
+var defaultClient = &PromMetricsClient{}
+
+// scrape scrapes a single target. The state is carried between scrapes of the
+// same target and may be nil.
+func (o *ScrapeOptions) scrape(ctx context.Context, t *Target, st *scrapeState) *ScrapeResult {
+	c := o.Client
+	if c == nil {
+		c = defaultClient
+	}
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	// the sample limit applies after metric relabeling, as in Prometheus
+	limits := c.Limits
+	var maxSamples int
+	if limits != nil && limits.MaxSamples > 0 && len(o.MetricRelabelConfigs) > 0 {
+		l := *limits
+		maxSamples, l.MaxSamples = l.MaxSamples, 0
+		limits = &l
+	}
+
+	r := ScrapeResult{Target: t, Time: time.Now()}
+	r.Metrics, r.Bytes, r.Err = c.fetch(ctx, t.URL, limits)
+	r.Duration = time.Since(r.Time)
+
+	scraped := countSamples(r.Metrics)
+
+	if o.IgnoreTimestamps {
+		ts := r.Time.UnixNano() / int64(time.Millisecond)
+		for _, m := range r.Metrics {
+			for _, s := range m.Samples {
+				s.Timestamp = ts
+			}
+		}
+	}
+
+	lbs := targetLabels(t)
+	attachTargetLabels(r.Metrics, lbs, o.HonorLabels)
+	r.Metrics = RelabelMetrics(r.Metrics, o.MetricRelabelConfigs)
+
+	if maxSamples > 0 && countSamples(r.Metrics) > maxSamples {
+		r.Metrics = nil
+		r.Err = &LimitError{Limit: SampleLimit, Max: int64(maxSamples), Line: -1}
+	}
+
+	if o.SyntheticMetrics {
+		if st == nil {
+			st = &scrapeState{}
+		}
+		sms := scrapeHealthMetrics(&r, scraped, st.countSeriesAdded(r.Metrics))
+		attachTargetLabels(sms, lbs, true)
+		r.Metrics = append(r.Metrics, sms...)
+	}
+
+	// a cancelled scrape says nothing about the health of the target
+	if o.Health != nil && ctx.Err() != context.Canceled {
+		o.Health.Record(&r)
+	}
+
+	return &r
+}
+
+// Scraper scrapes many targets concurrently with a bounded number of workers.
+type Scraper struct {
+	ScrapeOptions
+	Targets []*Target
+	// Concurrency is the maximum number of concurrent scrapes. Defaults to 10.
+	Concurrency int
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+	done   chan struct{}
+	// states are carried between scrapes, keyed by target
+	states map[string]*scrapeState
+}
+
+// Scrape scrapes all targets and returns the results in the same order as the
+// targets.
+func (s *Scraper) Scrape(ctx context.Context) []*ScrapeResult {
+	rs := make([]*ScrapeResult, len(s.Targets))
+	s.run(ctx, func(i int, r *ScrapeResult) {
+		rs[i] = r
+	})
+	return rs
+}
+
+// ScrapeChan scrapes all targets in the background, sending results on the
+// returned channel as they complete. The channel is closed when all targets
+// have been scraped.
+func (s *Scraper) ScrapeChan(ctx context.Context) <-chan *ScrapeResult {
+	ch := make(chan *ScrapeResult, len(s.Targets))
+	go func() {
+		s.run(ctx, func(i int, r *ScrapeResult) {
+			ch <- r
+		})
+		close(ch)
+	}()
+	return ch
+}
+
+// Close stops new scrapes from starting and waits for in-flight scrapes to
+// finish. Targets that were not scraped have their result error set to
+// ErrScraperClosed.
+func (s *Scraper) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		if s.done != nil {
+			close(s.done)
+		}
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// start registers a run with the scraper, returning false if it is closed. It
+// returns the state of each target, dropping the state of targets that are no
+// longer scraped.
+func (s *Scraper) start() (<-chan struct{}, []*scrapeState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil, false
+	}
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+
+	states := make(map[string]*scrapeState, len(s.Targets))
+	sts := make([]*scrapeState, len(s.Targets))
+	for i, t := range s.Targets {
+		k := targetKey(t)
+		st, ok := states[k]
+		if !ok {
+			if st, ok = s.states[k]; !ok {
+				st = &scrapeState{}
+			}
+			states[k] = st
+		}
+		sts[i] = st
+	}
+	s.states = states
+
+	s.wg.Add(1)
+	return s.done, sts, true
+}
+
+// run scrapes every target, calling fn with each result. fn is never called
+// concurrently.
+func (s *Scraper) run(ctx context.Context, fn func(int, *ScrapeResult)) {
+	done, sts, ok := s.start()
+	if !ok {
+		for i, t := range s.Targets {
+			fn(i, &ScrapeResult{Target: t, Err: ErrScraperClosed})
+		}
+		return
+	}
+	defer s.wg.Done()
+
+	n := s.Concurrency
+	if n <= 0 {
+		n = defaultScrapeConcurrency
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	idx := make(chan int)
+
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				t := s.Targets[i]
+
+				var r *ScrapeResult
+				select {
+				case <-done:
+					r = &ScrapeResult{Target: t, Err: ErrScraperClosed}
+				case <-ctx.Done():
+					r = &ScrapeResult{Target: t, Err: ctx.Err()}
+				default:
+					r = s.scrape(ctx, t, sts[i])
+				}
+
+				mu.Lock()
+				fn(i, r)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range s.Targets {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+}
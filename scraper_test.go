@@ -0,0 +1,310 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTargets(url string, n int) []*Target {
+	var ts []*Target
+	for i := 0; i < n; i++ {
+		ts = append(ts, &Target{URL: fmt.Sprintf("%s/metrics?n=%d", url, i)})
+	}
+	return ts
+}
+
+func TestScraperScrape(t *testing.T) {
+	var inflight, maxInflight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if req.URL.Query().Get("n") == "3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{Targets: newTargets(srv.URL, 20), Concurrency: 4}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+
+	if len(rs) != 20 {
+		t.Fatal("incorrect results length")
+	}
+
+	for i, r := range rs {
+		if r.Target != s.Targets[i] {
+			t.Fatal("results not in target order")
+		}
+
+		if i == 3 {
+			if !errors.Is(r.Err, ErrUnexpectedHTTPStatusCode) {
+				t.Fatal("expected unexpected HTTP status code error")
+			}
+			continue
+		}
+
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+
+		if m := findMetric(t, r.Metrics, "go_goroutines"); m.Samples[0].Value != 166 {
+			t.Fatal("incorrect gauge value")
+		}
+
+		if r.Bytes == 0 || r.Duration == 0 || r.Time.IsZero() {
+			t.Fatal("missing scrape stats")
+		}
+	}
+
+	if maxInflight > 4 {
+		t.Fatal("concurrency limit exceeded", maxInflight)
+	}
+}
+
+func TestScraperScrapeChan(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{Targets: newTargets(srv.URL, 5)}
+	defer s.Close()
+
+	var n int
+	for r := range s.ScrapeChan(context.Background()) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		n++
+	}
+
+	if n != 5 {
+		t.Fatal("incorrect number of results")
+	}
+}
+
+func TestScraperContextCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{Targets: newTargets(srv.URL, 3)}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, r := range s.Scrape(ctx) {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Fatal("expected context cancelled error")
+		}
+	}
+}
+
+func TestScraperTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{Timeout: 50 * time.Millisecond},
+		Targets:       newTargets(srv.URL, 1),
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+	if !errors.Is(rs[0].Err, context.DeadlineExceeded) {
+		t.Fatal("expected deadline exceeded error", rs[0].Err)
+	}
+}
+
+func TestScraperCloseWaitsForInflight(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{Targets: newTargets(srv.URL, 3), Concurrency: 1}
+	ch := s.ScrapeChan(context.Background())
+
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("close returned before in-flight scrape finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-closed
+
+	var rs []*ScrapeResult
+	for r := range ch {
+		rs = append(rs, r)
+	}
+
+	if len(rs) != 3 {
+		t.Fatal("incorrect number of results")
+	}
+
+	if rs[0].Err != nil {
+		t.Fatal(rs[0].Err)
+	}
+
+	if !errors.Is(rs[1].Err, ErrScraperClosed) || !errors.Is(rs[2].Err, ErrScraperClosed) {
+		t.Fatal("expected scraper closed error")
+	}
+
+	if rs := s.Scrape(context.Background()); !errors.Is(rs[0].Err, ErrScraperClosed) {
+		t.Fatal("expected scraper closed error")
+	}
+}
+
+func TestAttachTargetLabels(t *testing.T) {
+	newMetrics := func() []*Metric {
+		return []*Metric{{
+			Name: "up",
+			Samples: []*Sample{
+				{Name: "up", Labels: map[string]string{"job": "scraped", "exported_job": "exported", "foo": "bar"}},
+				{Name: "up"},
+			},
+		}}
+	}
+	lbs := map[string]string{"job": "target", "instance": "localhost:9100", "foo": ""}
+
+	ms := newMetrics()
+	attachTargetLabels(ms, lbs, false)
+
+	s := ms[0].Samples[0]
+	if s.Labels["job"] != "target" || s.Labels["exported_exported_job"] != "scraped" || s.Labels["exported_job"] != "exported" {
+		t.Fatal("expected conflicting scraped label to be exported", s.Labels)
+	}
+
+	if s.Labels["exported_foo"] != "bar" {
+		t.Fatal("expected scraped label to be exported", s.Labels)
+	}
+
+	if _, ok := s.Labels["foo"]; ok {
+		t.Fatal("expected empty label to be removed")
+	}
+
+	if ms[0].Samples[1].Labels["job"] != "target" || ms[0].Samples[1].Labels["instance"] != "localhost:9100" {
+		t.Fatal("expected target labels to be attached")
+	}
+
+	ms = newMetrics()
+	attachTargetLabels(ms, lbs, true)
+
+	s = ms[0].Samples[0]
+	if s.Labels["job"] != "scraped" || s.Labels["foo"] != "bar" || s.Labels["instance"] != "localhost:9100" {
+		t.Fatal("expected scraped labels to be honored", s.Labels)
+	}
+}
+
+func TestScraperIgnoreTimestamps(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/example.txt")
+	}))
+	defer srv.Close()
+
+	for _, ignore := range []bool{false, true} {
+		s := Scraper{
+			ScrapeOptions: ScrapeOptions{IgnoreTimestamps: ignore},
+			Targets:       []*Target{{URL: srv.URL}},
+		}
+
+		rs := s.Scrape(context.Background())
+		s.Close()
+		if rs[0].Err != nil {
+			t.Fatal(rs[0].Err)
+		}
+
+		ts := rs[0].Time.UnixNano() / int64(time.Millisecond)
+		m := findMetric(t, rs[0].Metrics, "http_requests_total")
+
+		if !ignore && m.Samples[0].Timestamp != 1395066363000 {
+			t.Fatal("expected timestamp to be honored")
+		}
+
+		if ignore && m.Samples[0].Timestamp != ts {
+			t.Fatal("expected timestamp to be replaced with the scrape time")
+		}
+	}
+}
+
+func TestScraperDefaultInstanceLabel(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	})
+	a := httptest.NewServer(handler)
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{SyntheticMetrics: true},
+		Targets: []*Target{
+			{URL: a.URL, Labels: map[string]string{"job": "j"}},
+			{URL: b.URL, Labels: map[string]string{"job": "j"}},
+		},
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+
+	series := map[string]bool{}
+	for i, r := range rs {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+
+		instance := strings.TrimPrefix(s.Targets[i].URL, "http://")
+		smp := findMetric(t, r.Metrics, "go_goroutines").Samples[0]
+		if smp.Labels["instance"] != instance || smp.Labels["job"] != "j" {
+			t.Fatal("expected instance label to default to the target host", smp.Labels)
+		}
+
+		if up := findMetric(t, r.Metrics, "up").Samples[0]; up.Labels["instance"] != instance {
+			t.Fatal("expected synthetic metrics to have the same instance label", up.Labels)
+		}
+
+		series[seriesKey(smp)] = true
+	}
+
+	if len(series) != 2 {
+		t.Fatal("expected the series of each target to be distinct")
+	}
+}
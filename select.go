@@ -0,0 +1,277 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchType is the comparison a Matcher makes
+type MatchType int
+
+// Match types, as in PromQL
+const (
+	MatchEqual MatchType = iota
+	MatchNotEqual
+	MatchRegexp
+	MatchNotRegexp
+)
+
+func (t MatchType) String() string {
+	switch t {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	case MatchNotRegexp:
+		return "!~"
+	}
+	return fmt.Sprintf("MatchType(%d)", int(t))
+}
+
+// Matcher matches the value of a label. A missing label has an empty value.
+// The __name__ label matches the sample name, so histogram and summary samples
+// are matched by their full name e.g. http_request_duration_seconds_bucket.
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// NewMatcher creates a matcher. Regexes are anchored at both ends.
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := Matcher{Type: t, Name: name, Value: value}
+	switch t {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown match type %d", int(t))
+	}
+	return &m, nil
+}
+
+// Matches reports whether the value matches
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// matchesSample reports whether the sample name or label value matches
+func (m *Matcher) matchesSample(s *Sample) bool {
+	if m.Name == MetricNameLabel {
+		return m.Matches(s.Name)
+	}
+	return m.Matches(s.Labels[m.Name])
+}
+
+// Select returns the metric families with the samples that match a PromQL
+// style selector e.g. http_requests_total{code=~"5..",method!="get"}.
+// Families with no matching samples are not returned.
+func Select(ms []*Metric, selector string) ([]*Metric, error) {
+	matchers, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return SelectMatchers(ms, matchers...), nil
+}
+
+// SelectMatchers returns the metric families with the samples that match all
+// of the matchers. Families with no matching samples are not returned.
+func SelectMatchers(ms []*Metric, matchers ...*Matcher) []*Metric {
+	var out []*Metric
+	for _, m := range ms {
+		var samples []*Sample
+		for _, s := range m.Samples {
+			if matchesAll(matchers, s) {
+				samples = append(samples, s)
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		out = append(out, &Metric{Name: m.Name, Description: m.Description, Type: m.Type, Samples: samples})
+	}
+	return out
+}
+
+func matchesAll(matchers []*Matcher, s *Sample) bool {
+	for _, m := range matchers {
+		if !m.matchesSample(s) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	selectorNameRegex  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*`)
+	selectorLabelRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+)
+
+// ParseSelector parses a PromQL style selector into matchers. The selector is
+// an optional metric name followed by optional label matchers in braces, e.g.
+// up, {job="node"} or http_requests_total{code=~"5.."}.
+func ParseSelector(selector string) ([]*Matcher, error) {
+	p := selectorParser{s: selector}
+	var matchers []*Matcher
+
+	p.skipSpace()
+	if name := p.match(selectorNameRegex); name != "" {
+		m, _ := NewMatcher(MatchEqual, MetricNameLabel, name)
+		matchers = append(matchers, m)
+	}
+
+	p.skipSpace()
+	if p.consume("{") {
+		for {
+			p.skipSpace()
+			if p.consume("}") {
+				break
+			}
+
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+
+			p.skipSpace()
+			if p.consume("}") {
+				break
+			}
+			if !p.consume(",") {
+				return nil, p.errorf("expected , or }")
+			}
+		}
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	if len(matchers) == 0 {
+		return nil, p.errorf("selector must contain a metric name or label matcher")
+	}
+	return matchers, nil
+}
+
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("invalid selector %q at position %d: %s", p.s, p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *selectorParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *selectorParser) consume(tok string) bool {
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *selectorParser) match(re *regexp.Regexp) string {
+	m := re.FindString(p.s[p.pos:])
+	p.pos += len(m)
+	return m
+}
+
+func (p *selectorParser) parseMatcher() (*Matcher, error) {
+	name := p.match(selectorLabelRegex)
+	if name == "" {
+		return nil, p.errorf("expected label name")
+	}
+
+	p.skipSpace()
+	var t MatchType
+	switch {
+	case p.consume("=~"):
+		t = MatchRegexp
+	case p.consume("!~"):
+		t = MatchNotRegexp
+	case p.consume("!="):
+		t = MatchNotEqual
+	case p.consume("="):
+		t = MatchEqual
+	default:
+		return nil, p.errorf("expected one of =, !=, =~ or !~")
+	}
+
+	p.skipSpace()
+	value, err := p.parseString()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMatcher(t, name, value)
+	if err != nil {
+		return nil, p.errorf("%s", err)
+	}
+	return m, nil
+}
+
+// parseString parses a single or double quoted string, unescaping \\, \n and
+// the quote character
+func (p *selectorParser) parseString() (string, error) {
+	if p.pos >= len(p.s) || (p.s[p.pos] != '"' && p.s[p.pos] != '\'') {
+		return "", p.errorf("expected quoted string")
+	}
+	quote := p.s[p.pos]
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			e := p.s[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"', '\'':
+				b.WriteByte(e)
+			default:
+				// keep unknown escapes so regexes such as \. work
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
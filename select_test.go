@@ -0,0 +1,88 @@
+package client
+
+import (
+	"os"
+	"testing"
+)
+
+func parseExample(t *testing.T) []*Metric {
+	f, err := os.Open("testdata/example.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ms, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+func countSelected(t *testing.T, ms []*Metric, selector string) int {
+	out, err := Select(ms, selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return countSamples(out)
+}
+
+func TestSelect(t *testing.T) {
+	ms := parseExample(t)
+
+	tests := []struct {
+		selector string
+		samples  int
+	}{
+		{`http_requests_total`, 2},
+		{`http_requests_total{code="200"}`, 1},
+		{`http_requests_total{code!="200", method="post"}`, 1},
+		{`http_requests_total{code=~"4.."}`, 1},
+		{`http_requests_total{code!~"[24].."}`, 0},
+		{`http_requests_total{method=""}`, 0},
+		{`metric_without_timestamp_and_labels{method=""}`, 1},
+		{`{__name__=~"http_.*"}`, 10},
+		{`http_request_duration_seconds`, 0},
+		{`http_request_duration_seconds_bucket`, 6},
+		{`http_request_duration_seconds_bucket{le=~"0\\..*"}`, 4},
+		{`http_request_duration_seconds_count`, 1},
+		{`rpc_duration_seconds`, 5},
+		{`{__name__=~"rpc_duration_seconds_(sum|count)"}`, 2},
+		{`{quantile="0.99"}`, 1},
+		{`msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT"}`, 1},
+		{`msdos_file_access_time_seconds{error=~"Cannot find file:\n.*"}`, 1},
+		{` up { job = 'node' , } `, 0},
+	}
+
+	for _, tt := range tests {
+		if n := countSelected(t, ms, tt.selector); n != tt.samples {
+			t.Fatal("incorrect samples selected for", tt.selector, n)
+		}
+	}
+
+	out, _ := Select(ms, `http_request_duration_seconds_sum`)
+	if len(out) != 1 || out[0].Name != "http_request_duration_seconds" || out[0].Type != HistogramType {
+		t.Fatal("expected family metadata to be kept")
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	invalid := []string{
+		``,
+		`{}`,
+		`up{`,
+		`up{job}`,
+		`up{job=node}`,
+		`up{job="node"`,
+		`up{job=="node"}`,
+		`up{job="node" instance="a"}`,
+		`up{job=~"("}`,
+		`up}`,
+	}
+
+	for _, s := range invalid {
+		if _, err := ParseSelector(s); err == nil {
+			t.Fatal("expected parse error for", s)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// stdin is read for the "-" target
+var stdin io.Reader = os.Stdin
+
+func openStdin() (io.ReadCloser, error) {
+	return maybeGunzip(stdin)
+}
+
+// openFile opens a file:///path/to/metrics.txt URL, decompressing it if it
+// is gzip compressed.
+func openFile(ctx context.Context, target string) (io.ReadCloser, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("invalid file URL %s: host must be empty", target)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := maybeGunzip(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: zr, closers: []io.Closer{zr, f}}, nil
+}
+
+// parseUnixURL splits a unix:///path/to/sock:/metrics URL into the socket path
+// and the HTTP path, which defaults to /metrics. The socket path ends at the
+// first ":", so the HTTP path and query may contain colons.
+func parseUnixURL(target string) (string, string, error) {
+	rest := strings.TrimPrefix(target, "unix://")
+	if rest == target || !strings.HasPrefix(rest, "/") {
+		return "", "", fmt.Errorf("invalid unix socket URL %s", target)
+	}
+
+	sock, path := rest, "/metrics"
+	if i := strings.Index(rest, ":"); i > -1 {
+		sock, path = rest[:i], rest[i+1:]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	return sock, path, nil
+}
+
+// unixRoundTripper returns the transport for HTTP requests over the unix
+// socket, creating it on first use. Requests are authenticated with OAuth2 in
+// the same way as HTTP targets.
+func (c *PromMetricsClient) unixRoundTripper(sock string) (http.RoundTripper, error) {
+	ts := c.transports()
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if rt, ok := ts.unix[sock]; ok {
+		return rt, nil
+	}
+
+	var rt http.RoundTripper = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}
+
+	if c.OAuth2 != nil {
+		ort, err := newOAuth2RoundTripper(c.OAuth2, rt)
+		if err != nil {
+			return nil, err
+		}
+		rt = ort
+	}
+
+	if ts.unix == nil {
+		ts.unix = map[string]http.RoundTripper{}
+	}
+	ts.unix[sock] = rt
+	return rt, nil
+}
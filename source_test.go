@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUnixURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		sock string
+		path string
+	}{
+		{"unix:///run/exporter.sock:/metrics", "/run/exporter.sock", "/metrics"},
+		{"unix:///run/exporter.sock:/custom/path", "/run/exporter.sock", "/custom/path"},
+		{"unix:///run/exporter.sock", "/run/exporter.sock", "/metrics"},
+		{"unix:///run/exporter.sock:/metrics?t=a:b", "/run/exporter.sock", "/metrics?t=a:b"},
+		{"unix:///run/exporter.sock:/a:b", "/run/exporter.sock", "/a:b"},
+	}
+
+	for _, tt := range tests {
+		sock, path, err := parseUnixURL(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sock != tt.sock || path != tt.path {
+			t.Fatal("incorrect socket or path", sock, path)
+		}
+	}
+
+	if _, _, err := parseUnixURL("unix://relative.sock"); err == nil {
+		t.Fatal("expected invalid unix socket URL error")
+	}
+}
+
+func TestGetUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "exporter.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	})
+	go http.Serve(listener, mux)
+
+	c := PromMetricsClient{URL: "unix://" + sock + ":/metrics"}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+
+	c = PromMetricsClient{URL: "unix://" + sock + ":/missing"}
+
+	_, err = c.GetMetrics()
+
+	var herr *HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != 404 {
+		t.Fatal("expected not found HTTPError")
+	}
+
+	if herr.URL != c.URL {
+		t.Fatal("incorrect HTTPError URL", herr.URL)
+	}
+}
+
+func TestGetUnixSocketOAuth2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "exporter.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var auth string
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+
+	var fetches int32
+	tsrv := newTokenServer(3600, &fetches)
+	defer tsrv.Close()
+
+	c := PromMetricsClient{
+		URL: "unix://" + sock + ":/metrics",
+		OAuth2: &OAuth2Config{
+			ClientID:     "client",
+			ClientSecret: "s3cret",
+			TokenURL:     tsrv.URL,
+		},
+	}
+
+	if _, err := c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Bearer token-1" {
+		t.Fatal("incorrect authorization header", auth)
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	path, err := filepath.Abs("testdata/memstats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := PromMetricsClient{URL: "file://" + path}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "go_memstats_heap_objects"); m.Samples[0].Value != 33814 {
+		t.Fatal("incorrect gauge value")
+	}
+
+	c = PromMetricsClient{
+		URL:    "file://" + path,
+		Limits: &Limits{MaxSamples: 10},
+	}
+
+	if _, err := c.GetMetrics(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatal("expected limit exceeded error")
+	}
+
+	c = PromMetricsClient{URL: "file://" + path + ".missing"}
+
+	if _, err := c.GetMetrics(); !os.IsNotExist(err) {
+		t.Fatal("expected not exist error")
+	}
+}
+
+func TestGetStdin(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/multisample.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := stdin
+	stdin = bytes.NewReader(content)
+	defer func() { stdin = orig }()
+
+	c := PromMetricsClient{URL: "-"}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "hydrabooster_connected_peers"); len(m.Samples) != 2 {
+		t.Fatal("incorrect samples length")
+	}
+}
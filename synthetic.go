@@ -0,0 +1,105 @@
+package client
+
+import (
+	"net/url"
+	"sync"
+)
+
+// scrapeState is carried between scrapes of the same target
+type scrapeState struct {
+	mu     sync.Mutex
+	series map[string]struct{}
+}
+
+// targetInstance returns the instance label of the target, defaulting to the
+// host and port of its URL.
+func targetInstance(t *Target) string {
+	if i, ok := t.Labels["instance"]; ok {
+		return i
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil || u.Host == "" {
+		return t.URL
+	}
+	return u.Host
+}
+
+// targetLabels returns the labels attached to the samples scraped from the
+// target. The instance label defaults to targetInstance, as in Prometheus.
+func targetLabels(t *Target) map[string]string {
+	lbs := copyLabels(t.Labels)
+	lbs["instance"] = targetInstance(t)
+	return lbs
+}
+
+// seriesKey identifies a sample by its name and labels
+func seriesKey(s *Sample) string {
+	return s.Series().Key()
+}
+
+// countSeriesAdded counts the series in ms that were not present in the
+// previous scrape, and records them for the next.
+func (st *scrapeState) countSeriesAdded(ms []*Metric) int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	series := map[string]struct{}{}
+	var n int
+	for _, m := range ms {
+		for _, s := range m.Samples {
+			k := seriesKey(s)
+			series[k] = struct{}{}
+			if _, ok := st.series[k]; !ok {
+				n++
+			}
+		}
+	}
+	st.series = series
+	return n
+}
+
+// countSamples counts the samples in all metric families
+func countSamples(ms []*Metric) int {
+	var n int
+	for _, m := range ms {
+		n += len(m.Samples)
+	}
+	return n
+}
+
+func syntheticMetric(name, help string, v float64, lbs map[string]string) *Metric {
+	return &Metric{
+		Name:        name,
+		Description: help,
+		Type:        GaugeType,
+		Samples: []*Sample{{
+			Name:   name,
+			Labels: lbs,
+			Value:  v,
+		}},
+	}
+}
+
+// scrapeHealthMetrics creates the synthetic metrics Prometheus reports for every scrape
+func scrapeHealthMetrics(r *ScrapeResult, samples, seriesAdded int) []*Metric {
+	lbs := func() map[string]string {
+		l := map[string]string{"instance": targetInstance(r.Target)}
+		if j, ok := r.Target.Labels["job"]; ok {
+			l["job"] = j
+		}
+		return l
+	}
+
+	var up float64
+	if r.Err == nil {
+		up = 1
+	}
+
+	return []*Metric{
+		syntheticMetric("up", "1 if the target was scraped successfully, 0 otherwise.", up, lbs()),
+		syntheticMetric("scrape_duration_seconds", "Duration of the scrape in seconds.", r.Duration.Seconds(), lbs()),
+		syntheticMetric("scrape_samples_scraped", "Number of samples the target exposed.", float64(samples), lbs()),
+		syntheticMetric("scrape_series_added", "Number of series in the scrape that were not in the previous scrape.", float64(seriesAdded), lbs()),
+		syntheticMetric("scrape_response_size_bytes", "Size of the uncompressed response in bytes.", float64(r.Bytes), lbs()),
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSyntheticMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{SyntheticMetrics: true},
+		Targets: []*Target{
+			{URL: srv.URL + "/metrics", Labels: map[string]string{"job": "node"}},
+			{URL: srv.URL + "/down", Labels: map[string]string{"job": "node", "instance": "down:9100"}},
+		},
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+
+	ms := rs[0].Metrics
+	up := findMetric(t, ms, "up")
+
+	if up.Samples[0].Value != 1 {
+		t.Fatal("incorrect up value")
+	}
+
+	if up.Samples[0].Labels["job"] != "node" {
+		t.Fatal("incorrect job label")
+	}
+
+	if up.Samples[0].Labels["instance"] != strings.TrimPrefix(srv.URL, "http://") {
+		t.Fatal("incorrect instance label")
+	}
+
+	if m := findMetric(t, ms, "scrape_samples_scraped"); m.Samples[0].Value != 34 {
+		t.Fatal("incorrect samples scraped")
+	}
+
+	if m := findMetric(t, ms, "scrape_series_added"); m.Samples[0].Value != 34 {
+		t.Fatal("incorrect series added")
+	}
+
+	if m := findMetric(t, ms, "scrape_response_size_bytes"); m.Samples[0].Value != 4653 {
+		t.Fatal("incorrect response size")
+	}
+
+	if m := findMetric(t, ms, "scrape_duration_seconds"); m.Samples[0].Value <= 0 {
+		t.Fatal("incorrect scrape duration")
+	}
+
+	if rs[1].Err == nil {
+		t.Fatal("expected scrape error")
+	}
+
+	up = findMetric(t, rs[1].Metrics, "up")
+
+	if up.Samples[0].Value != 0 {
+		t.Fatal("incorrect up value")
+	}
+
+	if up.Samples[0].Labels["instance"] != "down:9100" {
+		t.Fatal("incorrect instance label")
+	}
+}
+
+func TestScraperSeriesAdded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	defer srv.Close()
+
+	s := Scraper{
+		ScrapeOptions: ScrapeOptions{SyntheticMetrics: true},
+		Targets:       []*Target{{URL: srv.URL + "/metrics"}},
+	}
+	defer s.Close()
+
+	rs := s.Scrape(context.Background())
+	if m := findMetric(t, rs[0].Metrics, "scrape_series_added"); m.Samples[0].Value != 34 {
+		t.Fatal("incorrect series added on first scrape")
+	}
+
+	rs = s.Scrape(context.Background())
+	if m := findMetric(t, rs[0].Metrics, "scrape_series_added"); m.Samples[0].Value != 0 {
+		t.Fatal("expected no series added on second scrape")
+	}
+
+	// a new target starts without state
+	s.Targets = append(s.Targets, &Target{URL: srv.URL + "/other"})
+
+	rs = s.Scrape(context.Background())
+	if m := findMetric(t, rs[0].Metrics, "scrape_series_added"); m.Samples[0].Value != 0 {
+		t.Fatal("expected state to be kept for existing target")
+	}
+	if m := findMetric(t, rs[1].Metrics, "scrape_series_added"); m.Samples[0].Value != 34 {
+		t.Fatal("incorrect series added for new target")
+	}
+}
+
+func TestCountSeriesAdded(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/multisample.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := Parse(bytes.NewBuffer(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var st scrapeState
+	if st.countSeriesAdded(ms) != 2 {
+		t.Fatal("expected all series to be added")
+	}
+
+	if st.countSeriesAdded(ms) != 0 {
+		t.Fatal("expected no series to be added")
+	}
+
+	ms[0].Samples[0].Labels["peer_id"] = "QmNew"
+	if st.countSeriesAdded(ms) != 1 {
+		t.Fatal("expected new series to be added")
+	}
+}
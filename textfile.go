@@ -0,0 +1,145 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TextfileConflict describes a metric in a textfile that conflicts with one
+// already read from another file in the same directory.
+type TextfileConflict struct {
+	// File is the path of the file containing the conflicting metric
+	File string
+	// Metric is the name of the conflicting metric
+	Metric string
+	// Reason describes the conflict
+	Reason string
+}
+
+func (c *TextfileConflict) Error() string {
+	return fmt.Sprintf("%s: %s: %s", c.File, c.Metric, c.Reason)
+}
+
+// ReadTextfileDir reads and merges metrics from every *.prom file in the
+// directory, the same way the node_exporter textfile collector does. Files
+// are read in name order. Metrics that appear in more than one file are merged
+// into a single family. A family whose TYPE differs from an earlier file is
+// skipped, as are duplicate series, and each is reported as a conflict. A
+// mismatched HELP is reported but its samples are kept.
+func ReadTextfileDir(dir string) ([]*Metric, []*TextfileConflict, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	for _, fi := range fis {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".prom") {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var ms []*Metric
+	var conflicts []*TextfileConflict
+	byName := map[string]*Metric{}
+	series := map[string]struct{}{}
+
+	for _, n := range names {
+		path := filepath.Join(dir, n)
+		fms, err := ParseFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		for _, fm := range fms {
+			m, ok := byName[fm.Name]
+			if !ok {
+				m = &Metric{Name: fm.Name, Description: fm.Description, Type: fm.Type}
+				byName[fm.Name] = m
+				ms = append(ms, m)
+			} else {
+				if typeName(fm.Type) != typeName(m.Type) {
+					conflicts = append(conflicts, &TextfileConflict{
+						File:   path,
+						Metric: fm.Name,
+						Reason: fmt.Sprintf("TYPE %q does not match %q", typeName(fm.Type), typeName(m.Type)),
+					})
+					continue
+				}
+				if fm.Description != m.Description {
+					conflicts = append(conflicts, &TextfileConflict{
+						File:   path,
+						Metric: fm.Name,
+						Reason: fmt.Sprintf("HELP %q does not match %q", fm.Description, m.Description),
+					})
+				}
+			}
+
+			for _, s := range fm.Samples {
+				k := seriesKey(s)
+				if _, ok := series[k]; ok {
+					conflicts = append(conflicts, &TextfileConflict{
+						File:   path,
+						Metric: fm.Name,
+						Reason: fmt.Sprintf("duplicate series %s", k),
+					})
+					continue
+				}
+				series[k] = struct{}{}
+				m.Samples = append(m.Samples, s)
+			}
+		}
+	}
+
+	return ms, conflicts, nil
+}
+
+func typeName(t MetricType) string {
+	if t == Untyped {
+		return "untyped"
+	}
+	return string(t)
+}
+
+// WriteTextfile writes the metrics to the named file atomically, by writing
+// to a temporary file in the same directory and renaming it. Readers never
+// see a partially written file.
+func WriteTextfile(name string, ms []*Metric) error {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := Encode(f, ms); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTextfiles(t *testing.T, dir string, files map[string]string) {
+	for n, c := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, n), []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadTextfileDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTextfiles(t, dir, map[string]string{
+		"a.prom": `# HELP backup_last_success_seconds Time of the last successful backup.
+# TYPE backup_last_success_seconds gauge
+backup_last_success_seconds{db="users"} 1600000000
+# TYPE backup_runs_total counter
+backup_runs_total 12
+backup_size_bytes{db="users"} 1024
+`,
+		"b.prom": `# HELP backup_last_success_seconds Last backup time.
+# TYPE backup_last_success_seconds gauge
+backup_last_success_seconds{db="orders"} 1600000100
+backup_last_success_seconds{db="users"} 1600000200
+# TYPE backup_runs_total gauge
+backup_runs_total 3
+# TYPE backup_size_bytes untyped
+backup_size_bytes{db="orders"} 2048
+`,
+		"ignored.txt": `ignored_metric 1
+`,
+	})
+
+	ms, conflicts, err := ReadTextfileDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ms) != 3 {
+		t.Fatal("incorrect metrics length")
+	}
+
+	m := findMetric(t, ms, "backup_last_success_seconds")
+
+	if m.Description != "Time of the last successful backup." {
+		t.Fatal("expected first HELP to be kept")
+	}
+
+	if len(m.Samples) != 2 {
+		t.Fatal("incorrect samples length")
+	}
+
+	if m.Samples[1].Labels["db"] != "orders" {
+		t.Fatal("expected samples to be merged")
+	}
+
+	if m := findMetric(t, ms, "backup_runs_total"); len(m.Samples) != 1 || m.Samples[0].Value != 12 {
+		t.Fatal("expected mismatched TYPE to be skipped")
+	}
+
+	if m := findMetric(t, ms, "backup_size_bytes"); len(m.Samples) != 2 {
+		t.Fatal("expected explicitly untyped samples to be merged")
+	}
+
+	if len(conflicts) != 3 {
+		t.Fatal("incorrect conflicts length", conflicts)
+	}
+
+	reasons := []string{"HELP", "duplicate series", "TYPE"}
+	for i, c := range conflicts {
+		if c.File != filepath.Join(dir, "b.prom") || !strings.HasPrefix(c.Reason, reasons[i]) {
+			t.Fatal("incorrect conflict", c)
+		}
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms, err := ParseFile("testdata/memstats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "memstats.prom")
+	if err := WriteTextfile(name, ms); err != nil {
+		t.Fatal(err)
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fis) != 1 {
+		t.Fatal("expected temporary file to be removed")
+	}
+
+	if fis[0].Mode().Perm() != 0644 {
+		t.Fatal("incorrect file mode")
+	}
+
+	rms, conflicts, err := ReadTextfileDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conflicts) != 0 {
+		t.Fatal("unexpected conflicts")
+	}
+
+	if m := findMetric(t, rms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig configures TLS for connections to HTTPS endpoints. Certificate
+// files are re-read when their modification time or size changes.
+type TLSConfig struct {
+	// CAFile is a PEM encoded CA bundle used to verify the server certificate.
+	// When empty the system roots are used.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile is a PEM encoded client certificate, used for mTLS.
+	CertFile string `yaml:"cert_file,omitempty"`
+	// KeyFile is the PEM encoded private key for CertFile.
+	KeyFile string `yaml:"key_file,omitempty"`
+	// ServerName overrides the server name used to verify the server certificate.
+	ServerName string `yaml:"server_name,omitempty"`
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// MinVersion is the minimum TLS version to accept e.g. tls.VersionTLS12.
+	MinVersion uint16 `yaml:"min_version,omitempty"`
+}
+
+// newTLSConfig reads the configured files and creates a *tls.Config
+func (c *TLSConfig) newTLSConfig() (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         c.MinVersion,
+	}
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("both cert and key file must be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
+
+// fileStamp identifies the version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// stamps stats the configured files so that changes on disk can be detected
+// without reading them on every request.
+func (c *TLSConfig) stamps() ([]fileStamp, error) {
+	var ss []fileStamp
+	for _, f := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, fileStamp{modTime: fi.ModTime(), size: fi.Size()})
+	}
+	return ss, nil
+}
+
+func stampsEqual(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// tlsRoundTripper is a http.RoundTripper that recreates its underlying
+// transport when the modification time or size of the TLS certificate files
+// changes.
+type tlsRoundTripper struct {
+	cfg *TLSConfig
+
+	mu     sync.Mutex
+	stamps []fileStamp
+	rt     *http.Transport
+}
+
+func newTLSRoundTripper(cfg *TLSConfig) (*tlsRoundTripper, error) {
+	rt := &tlsRoundTripper{cfg: cfg}
+	if _, err := rt.transport(); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// transport returns the current transport, rebuilding it if the certificate
+// files have changed since it was created.
+func (t *tlsRoundTripper) transport() (*http.Transport, error) {
+	ss, err := t.cfg.stamps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS files: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rt != nil && stampsEqual(ss, t.stamps) {
+		return t.rt, nil
+	}
+
+	tc, err := t.cfg.newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tc
+
+	if t.rt != nil {
+		t.rt.CloseIdleConnections()
+	}
+
+	t.stamps = ss
+	t.rt = tr
+	return tr, nil
+}
+
+func (t *tlsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+	return tr.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of the underlying transport.
+func (t *tlsRoundTripper) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rt != nil {
+		t.rt.CloseIdleConnections()
+	}
+}
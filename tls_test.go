@@ -0,0 +1,255 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, name string, typ string, b []byte) {
+	err := ioutil.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// genCert creates a certificate signed by parent (self signed if nil) and
+// returns it along with its key.
+func genCert(t *testing.T, cn string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent = tmpl
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writeCert(t *testing.T, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, keyFile, "EC PRIVATE KEY", kb)
+}
+
+func newMemstatsTLSServer(t *testing.T, dir string) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", srv.Certificate().Raw)
+	return srv
+}
+
+func TestTLSCAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newMemstatsTLSServer(t, dir)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:       srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{CAFile: filepath.Join(dir, "ca.pem")},
+	}
+
+	ms, err := c.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m := findMetric(t, ms, "go_goroutines"); m.Samples[0].Value != 166 {
+		t.Fatal("incorrect gauge value")
+	}
+
+	c = PromMetricsClient{URL: srv.URL + "/metrics"}
+	if _, err = c.GetMetrics(); err == nil {
+		t.Fatal("expected unknown authority error")
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newMemstatsTLSServer(t, dir)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{
+			CAFile:     filepath.Join(dir, "ca.pem"),
+			ServerName: "example.com",
+		},
+	}
+	if _, err = c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{
+			CAFile:     filepath.Join(dir, "ca.pem"),
+			ServerName: "not.example.org",
+		},
+	}
+	if _, err = c.GetMetrics(); err == nil {
+		t.Fatal("expected server name mismatch error")
+	}
+}
+
+func TestTLSInsecureSkipVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newMemstatsTLSServer(t, dir)
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:       srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{InsecureSkipVerify: true},
+	}
+	if _, err = c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := PromMetricsClient{
+		URL:       srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13},
+	}
+	if _, err = c.GetMetrics(); err == nil {
+		t.Fatal("expected protocol version error")
+	}
+}
+
+func TestTLSClientCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmc-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := genCert(t, "test ca", 1, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	var serial int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		serial = req.TLS.PeerCertificates[0].SerialNumber.Int64()
+		http.ServeFile(w, req, "testdata/memstats.txt")
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", srv.Certificate().Raw)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	cert, key := genCert(t, "client", 2, ca, caKey)
+	writeCert(t, certFile, keyFile, cert, key)
+
+	c := PromMetricsClient{
+		URL: srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{
+			CAFile:   filepath.Join(dir, "ca.pem"),
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		},
+	}
+
+	if _, err = c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if serial != 2 {
+		t.Fatal("incorrect client certificate")
+	}
+
+	cert, key = genCert(t, "client", 3, ca, caKey)
+	writeCert(t, certFile, keyFile, cert, key)
+
+	// file times may be coarser than the time between the two writes
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if serial != 3 {
+		t.Fatal("client certificate was not reloaded")
+	}
+
+	c = PromMetricsClient{
+		URL:       srv.URL + "/metrics",
+		TLSConfig: &TLSConfig{CAFile: filepath.Join(dir, "ca.pem")},
+	}
+	if _, err = c.GetMetrics(); err == nil {
+		t.Fatal("expected missing client certificate error")
+	}
+}
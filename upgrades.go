@@ -2,12 +2,15 @@ package client
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 )
 
-// HistogramMetric is a metric of type HistogramType
+// HistogramMetric is a single series of a metric of type HistogramType
 type HistogramMetric struct {
 	Metric
+	// Labels are the labels of the series, excluding le
+	Labels  map[string]string
 	Buckets []*HistogramBucket
 	Sum     float64
 	Count   float64
@@ -43,46 +46,87 @@ func findSamplesByName(m *Metric, n string) []*Sample {
 	return ss
 }
 
-// UpgradeHistogram upgrades a Metric of type HistorgramType to a HistogramMetric
+// UpgradeHistogram upgrades a Metric of type HistorgramType to a HistogramMetric.
+// The metric must have a single series, see UpgradeHistograms.
 func UpgradeHistogram(m *Metric) (*HistogramMetric, error) {
+	hms, err := UpgradeHistograms(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(hms) == 0 {
+		return nil, fmt.Errorf("missing or multiple sum sample(s)")
+	}
+	if len(hms) > 1 {
+		return nil, fmt.Errorf("metric has %d series, use UpgradeHistograms", len(hms))
+	}
+	return hms[0], nil
+}
+
+// UpgradeHistograms upgrades a Metric of type HistorgramType to a
+// HistogramMetric for each series in it. Samples are grouped into series by
+// their labels, excluding le, and the buckets of each series are sorted by LE.
+// Series are returned in the order they first appear.
+func UpgradeHistograms(m *Metric) ([]*HistogramMetric, error) {
 	if m.Type != HistogramType {
 		return nil, fmt.Errorf("metric is not a histogram")
 	}
 
-	sbs := findSamplesByName(m, m.Name+"_bucket")
-	var hbs []*HistogramBucket
-	for _, sb := range sbs {
-		le, err := strconv.ParseFloat(sb.Labels["le"], 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid le float64 value: %w", err)
-		}
-		hbs = append(hbs, &HistogramBucket{
-			LE:    le,
-			Value: sb.Value,
-		})
-	}
+	var hms []*HistogramMetric
+	byKey := map[string]*HistogramMetric{}
+	sums := map[*HistogramMetric]int{}
+	counts := map[*HistogramMetric]int{}
 
-	ss := findSamplesByName(m, m.Name+"_sum")
-	if len(ss) != 1 {
-		return nil, fmt.Errorf("missing or multiple sum sample(s)")
+	for _, s := range m.Samples {
+		lbs := LabelsFromMap(s.Labels).Without("le")
+		key := lbs.String()
+
+		hm, ok := byKey[key]
+		if !ok {
+			hm = &HistogramMetric{
+				Metric: Metric{
+					Name:        m.Name,
+					Description: m.Description,
+					Type:        m.Type,
+				},
+				Labels: lbs.Map(),
+			}
+			byKey[key] = hm
+			hms = append(hms, hm)
+		}
+		hm.Samples = append(hm.Samples, s)
+
+		switch s.Name {
+		case m.Name + "_bucket":
+			le, err := strconv.ParseFloat(s.Labels["le"], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid le float64 value: %w", err)
+			}
+			hm.Buckets = append(hm.Buckets, &HistogramBucket{
+				LE:    le,
+				Value: s.Value,
+			})
+		case m.Name + "_sum":
+			hm.Sum = s.Value
+			sums[hm]++
+		case m.Name + "_count":
+			hm.Count = s.Value
+			counts[hm]++
+		}
 	}
 
-	cs := findSamplesByName(m, m.Name+"_count")
-	if len(cs) != 1 {
-		return nil, fmt.Errorf("missing or multiple count sample(s)")
+	for _, hm := range hms {
+		if sums[hm] != 1 {
+			return nil, fmt.Errorf("missing or multiple sum sample(s) for series %s", LabelsFromMap(hm.Labels))
+		}
+		if counts[hm] != 1 {
+			return nil, fmt.Errorf("missing or multiple count sample(s) for series %s", LabelsFromMap(hm.Labels))
+		}
+		sort.SliceStable(hm.Buckets, func(i, j int) bool {
+			return hm.Buckets[i].LE < hm.Buckets[j].LE
+		})
 	}
 
-	return &HistogramMetric{
-		Metric: Metric{
-			Name:        m.Name,
-			Description: m.Description,
-			Type:        m.Type,
-			Samples:     m.Samples,
-		},
-		Buckets: hbs,
-		Sum:     ss[0].Value,
-		Count:   cs[0].Value,
-	}, nil
+	return hms, nil
 }
 
 // UpgradeSummary upgrades a Metric of type SummaryType to a SummaryMetric
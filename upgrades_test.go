@@ -24,6 +24,10 @@ func TestUpgradeHistogram(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	if len(h.Labels) != 0 || len(h.Samples) != 8 {
+		t.Fatal("incorrect histogram series")
+	}
+
 	if len(h.Buckets) != 6 {
 		t.Fatal("incorrect buckets length")
 	}
@@ -85,6 +89,76 @@ func TestUpgradeHistogram(t *testing.T) {
 	}
 }
 
+func TestUpgradeHistograms(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/histograms.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := Parse(bytes.NewBuffer(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := findMetric(t, ms, "http_request_duration_seconds")
+	hs, err := UpgradeHistograms(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hs) != 2 {
+		t.Fatal("incorrect histograms length")
+	}
+
+	a, b := hs[0], hs[1]
+
+	if a.Labels["handler"] != "/a" || a.Labels["method"] != "get" || len(a.Labels) != 2 {
+		t.Fatal("incorrect labels", a.Labels)
+	}
+
+	if b.Labels["handler"] != "/b" {
+		t.Fatal("incorrect labels", b.Labels)
+	}
+
+	if len(a.Buckets) != 3 || len(b.Buckets) != 2 {
+		t.Fatal("expected buckets not to be mixed between series")
+	}
+
+	for _, h := range hs {
+		for i := 1; i < len(h.Buckets); i++ {
+			if h.Buckets[i-1].LE >= h.Buckets[i].LE {
+				t.Fatal("expected buckets sorted by le")
+			}
+		}
+	}
+
+	if a.Buckets[0].LE != 0.1 || a.Buckets[0].Value != 5 || a.Buckets[2].LE != math.Inf(1) || a.Buckets[2].Value != 9 {
+		t.Fatal("incorrect buckets")
+	}
+
+	if a.Sum != 1.5 || a.Count != 9 || b.Sum != 0.25 || b.Count != 2 {
+		t.Fatal("incorrect sum or count")
+	}
+
+	if len(a.Samples) != 5 || len(b.Samples) != 4 {
+		t.Fatal("incorrect samples")
+	}
+
+	broken := &Metric{Name: "h", Type: HistogramType, Samples: []*Sample{
+		{Name: "h_bucket", Labels: map[string]string{"a": "1", "le": "+Inf"}, Value: 1},
+		{Name: "h_sum", Labels: map[string]string{"a": "1"}, Value: 1},
+		{Name: "h_count", Labels: map[string]string{"a": "2"}, Value: 1},
+	}}
+
+	if _, err := UpgradeHistograms(broken); err == nil {
+		t.Fatal("expected missing count error")
+	}
+
+	if _, err := UpgradeHistogram(m); err == nil {
+		t.Fatal("expected error upgrading many series to a single histogram")
+	}
+}
+
 func TestUpgradeSummary(t *testing.T) {
 	content, err := ioutil.ReadFile("testdata/example.txt")
 	if err != nil {